@@ -1,22 +1,45 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"math"
 	"os"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/iqdsp"
 	"github.com/jrwynneiii/lrittools/ziq"
 )
 
 var cli struct {
-	Verbose    bool   `help:"Prints debug output by default"`
-	File       string `arg:"" help:"Path to a ziq IQ file"`
-	OutputFile string `arg:"" help:"File path to output file"`
-	Normalize  bool   `help:"Writes normalized complex64 values to output" default:"true"`
+	Verbose      bool          `help:"Prints debug output by default"`
+	File         string        `arg:"" help:"Path to a ziq IQ file"`
+	OutputFile   string        `arg:"" help:"File path to output file, or - for stdout"`
+	OutputFormat string        `help:"Format of the output: cs8, cs16, cf32, cf64 or cu8 raw IQ, wav, or sigmf" enum:"cs8,cs16,cf32,cf64,cu8,wav,sigmf" default:"cf32"`
+	SampleFormat string        `help:"Sample format stored in wav (cu8, cs16, cf32 or cf64; cs16 by default) and sigmf (cf32 by default) output"`
+	Normalize    bool          `help:"Scale float output to +/-1.0; with --no-normalize it keeps the integer range of the ziq samples" default:"true" negatable:""`
+	ShiftHz      float64       `help:"Shift the spectrum by this many Hz before filtering; a signal at +offset Hz is centered with --shift-hz=-offset"`
+	Decimate     int           `help:"Low-pass filter the stream and keep every Nth sample" default:"1"`
+	ResampleTo   float64       `help:"Resample the output to this many samples per second"`
+	Start        time.Duration `help:"Offset into the recording to start from (e.g. 1h30m)"`
+	Duration     time.Duration `help:"Length of the recording to write; defaults to the rest of the file"`
+}
+
+// Default sample formats stored in each container
+var containerFormats = map[string]ziq.SampleFormat{
+	"wav":   ziq.CS16,
+	"sigmf": ziq.CF32,
+}
+
+// Full scale of the integer ziq formats, for --no-normalize
+var fullScale = map[ziq.SampleFormat]float32{
+	ziq.CS8:  127.0,
+	ziq.CS16: 32767.0,
+	ziq.CF32: 1.0,
 }
 
 func main() {
@@ -25,44 +48,216 @@ func main() {
 		log.SetLevel(log.DebugLevel)
 	}
 
-	output := ziq.Load(cli.File)
-	if output == nil {
-		log.Fatalf("File %s is not a valid ZIQ file", cli.File)
-		os.Exit(1)
+	output, err := ziq.Load(cli.File)
+	if err != nil {
+		log.Fatalf("File %s is not a valid ZIQ file: %s", cli.File, err.Error())
 	}
+	defer output.Close()
 
-	var outputfile *os.File
-	var err error
-	if outputfile, err = os.Open(cli.OutputFile); !errors.Is(err, os.ErrNotExist) {
-		log.Fatalf("Output file exists! Cowardly not overwriting file...")
-	} else if errors.Is(err, os.ErrNotExist) {
-		if outputfile, err = os.Create(cli.OutputFile); err != nil {
-			log.Fatalf("Could not open output file! %s", err.Error())
+	metadata, err := output.Metadata()
+	if err == nil {
+		log.Infof("Recording: format %s, sample rate %.0f, frequency %.0f Hz, start time %s, source %q", metadata.Format, metadata.SampleRate, metadata.Frequency, metadata.StartTime, metadata.Source)
+	} else {
+		log.Warnf("%s", err.Error())
+	}
+
+	if cli.Start > 0 {
+		if err := output.SeekTime(cli.Start); err != nil {
+			log.Fatalf("Could not seek to %s: %s", cli.Start, err.Error())
 		}
 	}
+	// Output metadata describes where we start writing from, not the start of the recording
+	if startTime, ok := metadata.SampleTime(output.Position()); ok {
+		metadata.StartTime = startTime
+	}
 
-	divisor := float32(127.0)
-	if cli.Normalize {
-		divisor = float32(1.0)
+	// A negative count means we read to the end of the recording
+	remaining := int64(-1)
+	if cli.Duration > 0 {
+		if output.SampleRate() == 0 {
+			log.Fatalf("Can not stop after --duration %s; %s has no sample rate", cli.Duration, cli.File)
+		}
+		remaining = int64(cli.Duration.Seconds() * output.SampleRate())
 	}
 
-	log.Debugf("Writing output file...")
-	for !output.Done {
-		buf := new(bytes.Buffer)
-		samples := output.GetNextChunk(66560)
+	sampleFormat, err := outputSampleFormat()
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	scale := float32(1.0)
+	if !cli.Normalize {
+		if sampleFormat == ziq.CF32 || sampleFormat == ziq.CF64 {
+			scale = fullScale[metadata.Format]
+		} else {
+			log.Warnf("--no-normalize only applies to float output; writing full scale %s", sampleFormat)
+		}
+	}
 
-		for _, val := range samples {
-			if err := binary.Write(buf, binary.LittleEndian, math.Float32bits(real(val)/divisor)); err != nil {
-				log.Fatalf("Error writing IQ file! %s", err.Error())
-			}
-			if err := binary.Write(buf, binary.LittleEndian, math.Float32bits(imag(val)/divisor)); err != nil {
-				log.Fatalf("Error writing IQ file! %s", err.Error())
+	stages, outputRate, err := buildStages(output.SampleRate())
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if outputRate != metadata.SampleRate {
+		log.Infof("Writing %.0f samples/s", outputRate)
+		metadata.SampleRate = outputRate
+	}
+	// After the shift, the center of the output is the recording's center less the shift
+	if metadata.Frequency != 0 {
+		metadata.Frequency -= cli.ShiftHz
+	}
+
+	outputfile, err := createOutput(sampleFormat, metadata, output.Header)
+	if err != nil {
+		log.Fatalf("Could not open output file! %s", err.Error())
+	}
+
+	log.Debugf("Writing %s output file...", cli.OutputFormat)
+	reader := ziq.StartReadAhead(output, 66560, 8)
+	defer reader.Close()
+
+	var processed, written int64
+	start := time.Now()
+	for remaining != 0 {
+		samples, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatalf("Could not read ZIQ file! %s", err.Error())
+		}
+		chunk := samples
+		if remaining > 0 {
+			chunk = chunk[:min(int64(len(chunk)), remaining)]
+			remaining -= int64(len(chunk))
+		}
+
+		if scale != 1.0 {
+			for i := range chunk {
+				chunk[i] *= complex(scale, 0)
 			}
 		}
+		read := len(chunk)
+		for _, stage := range stages {
+			chunk = stage.Process(chunk)
+		}
 
-		log.Debugf("Wrote chunk of %d samples to output file (%d bytes)", len(samples), len(buf.Bytes()))
-		if _, err = outputfile.Write(buf.Bytes()); err != nil {
-			log.Fatalf("Could not write to output file! %s", cli.OutputFile)
+		log.Debugf("Writing chunk of %d samples to output file", len(chunk))
+		if err = outputfile.WriteSamples(chunk); err != nil {
+			log.Fatalf("Could not write to output file %s! %s", cli.OutputFile, err.Error())
 		}
+		reader.Release(samples)
+		processed += int64(read)
+		written += int64(len(chunk))
+	}
+	if err := outputfile.Close(); err != nil {
+		log.Fatalf("Could not finish writing output file %s! %s", cli.OutputFile, err.Error())
+	}
+
+	elapsed := time.Since(start)
+	log.Infof("Wrote %d samples in %s (%.0f samples/s)", written, elapsed.Round(time.Millisecond), float64(processed)/elapsed.Seconds())
+}
+
+// Builds the shift, decimation and resampling stages, returning them along with the output rate
+func buildStages(sampleRate float64) ([]iqdsp.Stage, float64, error) {
+	var stages []iqdsp.Stage
+	if cli.ShiftHz != 0 {
+		if sampleRate == 0 {
+			return nil, 0, fmt.Errorf("Can not shift a recording without a sample rate")
+		}
+		stages = append(stages, iqdsp.NewMixer(cli.ShiftHz, sampleRate))
+	}
+	if cli.Decimate > 1 {
+		decimator, err := iqdsp.NewDecimator(cli.Decimate)
+		if err != nil {
+			return nil, 0, err
+		}
+		stages = append(stages, decimator)
+		sampleRate = decimator.OutputRate(sampleRate)
+	} else if cli.Decimate < 1 {
+		return nil, 0, fmt.Errorf("--decimate must be at least 1")
+	}
+	if cli.ResampleTo > 0 {
+		// The ratio is worked out in whole samples per second, from before any decimation
+		inRate := int64(math.Round(sampleRate * float64(cli.Decimate)))
+		resampler, err := iqdsp.NewRateResampler(inRate, int64(math.Round(cli.ResampleTo))*int64(cli.Decimate))
+		if err != nil {
+			return nil, 0, err
+		}
+		stages = append(stages, resampler)
+		sampleRate = resampler.OutputRate(sampleRate)
+	}
+	return stages, sampleRate, nil
+}
+
+// Returns the sample format to write, which is either the output format itself or the format
+// stored in the wav or sigmf container
+func outputSampleFormat() (ziq.SampleFormat, error) {
+	defaultFormat, isContainer := containerFormats[cli.OutputFormat]
+	if !isContainer {
+		if len(cli.SampleFormat) > 0 {
+			log.Warnf("--sample-format only applies to wav and sigmf output")
+		}
+		return ziq.ParseSampleFormat(cli.OutputFormat)
+	}
+	if len(cli.SampleFormat) == 0 {
+		return defaultFormat, nil
+	}
+	return ziq.ParseSampleFormat(cli.SampleFormat)
+}
+
+func createOutput(sampleFormat ziq.SampleFormat, metadata ziq.Metadata, header ziq.ZiqHeader) (ziq.SampleWriter, error) {
+	if cli.OutputFile == "-" {
+		out := bufio.NewWriterSize(os.Stdout, 1<<20)
+		var w ziq.SampleWriter
+		var err error
+		switch cli.OutputFormat {
+		case "sigmf":
+			return nil, fmt.Errorf("SigMF recordings are two files, and can not be written to stdout")
+		case "wav":
+			w, err = ziq.NewWAVWriter(out, sampleFormat, metadata.SampleRate)
+		default:
+			w, err = ziq.NewRawWriter(out, sampleFormat)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return stdoutWriter{w, out}, nil
+	}
+
+	paths := []string{cli.OutputFile}
+	if cli.OutputFormat == "sigmf" {
+		metaPath, dataPath := ziq.SigMFPaths(cli.OutputFile)
+		paths = []string{metaPath, dataPath}
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("Output file %s exists! Cowardly not overwriting file...", path)
+		}
+	}
+
+	switch cli.OutputFormat {
+	case "wav":
+		return ziq.CreateWAV(cli.OutputFile, sampleFormat, metadata.SampleRate)
+	case "sigmf":
+		global := map[string]any{"core:recorder": "unziq"}
+		if len(header.Annotation) > 0 {
+			global["ziq:annotation"] = header.Annotation
+			global["core:extensions"] = []map[string]any{{"name": "ziq", "version": "1.0.0", "optional": true}}
+		}
+		return ziq.CreateSigMF(cli.OutputFile, sampleFormat, metadata, global)
+	default:
+		return ziq.CreateRaw(cli.OutputFile, sampleFormat)
+	}
+}
+
+// Flushes buffered stdout once the samples have been written
+type stdoutWriter struct {
+	ziq.SampleWriter
+	out *bufio.Writer
+}
+
+func (w stdoutWriter) Close() error {
+	if err := w.SampleWriter.Close(); err != nil {
+		return err
 	}
+	return w.out.Flush()
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+var cli struct {
+	Verbose    bool   `help:"Prints debug output by default"`
+	File       string `arg:"" help:"Path to a raw IQ file, or - for stdin"`
+	OutputFile string `arg:"" help:"Path to write the ziq file to, or - for stdout"`
+	Format     string `help:"Sample format of the input: cs8, cs16 or cf32" enum:"cs8,cs16,cf32" required:""`
+	SampleRate uint64 `help:"Sample rate of the input" required:""`
+	Annotation string `help:"Annotation to store in the ziq header, e.g. a JSON object with frequency and start_time keys"`
+	Level      int    `help:"zstd compression level, from 1 (fastest) to 22 (smallest)" default:"5"`
+	Workers    int    `help:"Number of zstd frames to compress at once; defaults to the number of CPUs"`
+	NoCompress bool   `help:"Store the samples without compressing them"`
+}
+
+// Bits per sample stored in the ziq header for each input format
+var formatDepths = map[string]uint8{
+	"cs8":  8,
+	"cs16": 16,
+	"cf32": 32,
+}
+
+func main() {
+	_ = kong.Parse(&cli)
+	if cli.Verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	if cli.Level < 1 || cli.Level > 22 {
+		log.Fatalf("--level must be between 1 and 22, not %d", cli.Level)
+	}
+	if cli.Workers <= 0 {
+		cli.Workers = runtime.NumCPU()
+	}
+
+	header := ziq.ZiqHeader{
+		Compressed:    !cli.NoCompress,
+		BitsPerSample: formatDepths[cli.Format],
+		SampleRate:    cli.SampleRate,
+		Annotation:    cli.Annotation,
+	}
+	if _, err := header.Metadata(); err != nil {
+		log.Warnf("%s; storing the annotation as it is", err.Error())
+	}
+
+	var input io.Reader = os.Stdin
+	if cli.File != "-" {
+		f, err := os.Open(cli.File)
+		if err != nil {
+			log.Fatalf("Could not open input file! %s", err.Error())
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var out io.Writer = os.Stdout
+	var outFile *os.File
+	if cli.OutputFile != "-" {
+		if _, err := os.Stat(cli.OutputFile); !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("Output file %s exists! Cowardly not overwriting file...", cli.OutputFile)
+		}
+		f, err := os.Create(cli.OutputFile)
+		if err != nil {
+			log.Fatalf("Could not create output file! %s", err.Error())
+		}
+		outFile = f
+		out = f
+	}
+	buffered := bufio.NewWriterSize(out, 1024*1024)
+
+	writer, err := ziq.NewWriter(buffered, header)
+	if err != nil {
+		log.Fatalf("Could not write ziq header! %s", err.Error())
+	}
+	writer.Level = cli.Level
+	writer.Workers = cli.Workers
+
+	// Read whole samples at a time, so a short read never splits one across writes
+	sampleSize := int64(ziq.FormatForDepth(formatDepths[cli.Format]).SampleSize())
+	buf := make([]byte, 65536*sampleSize)
+	var read int64
+	start := time.Now()
+	for {
+		n, err := io.ReadFull(input, buf)
+		whole := n - n%int(sampleSize)
+		if whole > 0 {
+			if err := writer.WriteBody(buf[:whole]); err != nil {
+				log.Fatalf("Could not write to output file %s! %s", cli.OutputFile, err.Error())
+			}
+			read += int64(whole)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if n > whole {
+				log.Warnf("Input ends partway through a sample; dropping the last %d bytes", n-whole)
+			}
+			break
+		} else if err != nil {
+			log.Fatalf("Could not read input file! %s", err.Error())
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Could not finish writing output file %s! %s", cli.OutputFile, err.Error())
+	}
+	if err := buffered.Flush(); err != nil {
+		log.Fatalf("Could not finish writing output file %s! %s", cli.OutputFile, err.Error())
+	}
+	var written int64
+	if outFile != nil {
+		if info, err := outFile.Stat(); err == nil {
+			written = info.Size()
+		}
+		if err := outFile.Close(); err != nil {
+			log.Fatalf("Could not finish writing output file %s! %s", cli.OutputFile, err.Error())
+		}
+	}
+
+	elapsed := time.Since(start)
+	log.Infof("Wrote %d samples in %s (%.0f samples/s)", read/sampleSize, elapsed.Round(time.Millisecond), float64(read/sampleSize)/elapsed.Seconds())
+	if written > 0 {
+		log.Infof("Compressed %d bytes to %d bytes (ratio %.2f)", read, written, float64(read)/float64(written))
+	}
+}
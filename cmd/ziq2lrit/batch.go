@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+// What decoding one recording got out of it. Each recording in a batch run is decoded by a child
+// ziq2lrit, which writes one of these to --batch-summary for the combined summary
+type runSummary struct {
+	Recording      string  `json:"recording"`
+	OutputDir      string  `json:"output_dir"`
+	FilesWritten   int     `json:"files_written"`
+	FilesFailed    int     `json:"files_failed"`
+	Frames         int     `json:"frames"`
+	DroppedPackets int     `json:"dropped_packets"`
+	Seconds        float64 `json:"seconds"`
+	RC             int     `json:"rc"`
+}
+
+func (s runSummary) write(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, os.FileMode(0644))
+}
+
+// Expands the given files, globs and directories into a list of recordings. Directories are not
+// searched recursively, and only files with the extension of a format we can read are taken
+// from them
+func findRecordings(paths []string) ([]string, error) {
+	var recordings []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			recordings = append(recordings, path)
+		}
+	}
+
+	for _, path := range paths {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %s: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No recordings match %s", path)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				// A SigMF recording is a pair of files, so only take the metadata
+				if entry.IsDir() || len(ziq.FormatForPath(name)) == 0 || strings.HasSuffix(strings.ToLower(name), ".sigmf-data") {
+					continue
+				}
+				add(filepath.Join(match, name))
+			}
+		}
+	}
+	if len(recordings) == 0 {
+		return nil, fmt.Errorf("No recordings found in %s", strings.Join(paths, ", "))
+	}
+	return recordings, nil
+}
+
+// Returns a name for each recording, for its output to go by: its file name less the extension,
+// numbered where recordings share a name
+func recordingNames(recordings []string) map[string]string {
+	names := make(map[string]string)
+	used := make(map[string]int)
+	for _, recording := range recordings {
+		name := filepath.Base(recording)
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		// Recordings from different directories (or in different formats) can share a name
+		if used[name] += 1; used[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, used[name])
+		}
+		names[recording] = name
+	}
+	return names
+}
+
+// Returns the directory each recording's LRIT files go to: a subdirectory of --output-dir named
+// after the recording, or --output-dir itself with --shared-output-dir. Without --output-dir, the
+// directory of each recording stands in for it, as it does for ziqsplit
+func outputDirs(names map[string]string) map[string]string {
+	dirs := make(map[string]string)
+	for recording, name := range names {
+		dir := cli.OutputDir
+		if len(dir) == 0 {
+			dir = filepath.Dir(recording)
+		}
+		if cli.SharedOutputDir {
+			dirs[recording] = dir
+		} else {
+			dirs[recording] = filepath.Join(dir, name)
+		}
+	}
+	return dirs
+}
+
+// Flags that runJob sets for each child itself, or that only apply to the batch as a whole
+var batchFlags = map[string]bool{
+	"help":              true,
+	"file":              true,
+	"rtltcp":            true,
+	"output-dir":        true,
+	"shared-output-dir": true,
+	"jobs":              true,
+	"cadu-out":          true,
+	"soft-symbols-out":  true,
+	"no-tui":            true,
+	"dump-config":       true,
+	"batch-summary":     true,
+}
+
+// Returns the flags given on the command line to pass on to each child, less batchFlags
+func childArgs(flags []*kong.Flag) []string {
+	var args []string
+	for _, flag := range flags {
+		if batchFlags[flag.Name] || flag.Target.IsZero() {
+			continue
+		}
+		if flag.Target.Kind() == reflect.Slice {
+			for i := range flag.Target.Len() {
+				args = append(args, "--"+flag.Name+"="+flagValue(flag.Target.Index(i)))
+			}
+		} else {
+			args = append(args, "--"+flag.Name+"="+flagValue(flag.Target))
+		}
+	}
+	return args
+}
+
+// Formats a flag's value the way kong parses it
+func flagValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Duration:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Child ziq2lrit processes that are decoding a recording
+type jobList struct {
+	lock sync.Mutex
+	cmds map[*exec.Cmd]bool
+}
+
+func (j *jobList) add(cmd *exec.Cmd) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.cmds[cmd] = true
+}
+
+func (j *jobList) remove(cmd *exec.Cmd) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	delete(j.cmds, cmd)
+}
+
+func (j *jobList) signal(sig os.Signal) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for cmd := range j.cmds {
+		if err := cmd.Process.Signal(sig); err != nil {
+			log.Warnf("Could not signal ziq2lrit process %d: %s", cmd.Process.Pid, err.Error())
+		}
+	}
+}
+
+// Decodes each recording with its own ziq2lrit process, and so its own pipeline, running up to
+// --jobs of them at once, each given flags on top of its own. Returns the exit code of the worst
+// of them
+func runBatch(recordings []string, flags []string) int {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Could not find the ziq2lrit executable: %s", err.Error())
+	}
+	names := recordingNames(recordings)
+	dirs := outputDirs(names)
+	for _, recording := range recordings {
+		if dir := dirs[recording]; len(dir) > 0 {
+			if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+				log.Fatalf("Could not create output directory %s: %s", dir, err.Error())
+			}
+		}
+	}
+	log.Infof("Decoding %d recordings, %d at a time", len(recordings), cli.Jobs)
+
+	// The children ignore SIGINT, so that Ctrl-C in a terminal only reaches us. On a signal, no
+	// more recordings are started, and the ones running are told to finish up
+	stopping := make(chan struct{})
+	jobs := jobList{cmds: make(map[*exec.Cmd]bool)}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warnf("Got %s; finishing the recordings already started. Send it again to quit now", sig)
+		close(stopping)
+		jobs.signal(syscall.SIGTERM)
+		sig = <-signals
+		log.Errorf("Got %s again; quitting without finishing", sig)
+		jobs.signal(os.Kill)
+		os.Exit(RC_INTERRUPTED)
+	}()
+	if len(pauseSignals) > 0 {
+		pauses := make(chan os.Signal, 1)
+		signal.Notify(pauses, pauseSignals...)
+		go func() {
+			for sig := range pauses {
+				jobs.signal(sig)
+			}
+		}()
+	}
+
+	start := time.Now()
+	summaries := make([]runSummary, len(recordings))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range cli.Jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				summaries[i] = runJob(exe, flags, recordings[i], names[recordings[i]], dirs[recordings[i]], &jobs)
+			}
+		}()
+	}
+	started := 0
+queue:
+	for i := range recordings {
+		select {
+		case queue <- i:
+			started += 1
+		case <-stopping:
+			break queue
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	printSummary(summaries[:started], len(recordings), time.Since(start))
+	rc := RC_SUCCESS
+	for _, s := range summaries[:started] {
+		rc = max(rc, s.RC)
+	}
+	select {
+	case <-stopping:
+		rc = RC_INTERRUPTED
+	default:
+	}
+	return rc
+}
+
+// Decodes one recording in a child ziq2lrit, prefixing each line it logs with the recording's name.
+// Its CADUs and soft symbols go to files named after the recording
+func runJob(exe string, flags []string, recording, name, outputDir string, jobs *jobList) runSummary {
+	summary := runSummary{Recording: recording, OutputDir: outputDir, RC: RC_IO_ERROR}
+	summaryFile, err := os.CreateTemp("", "ziq2lrit-*.json")
+	if err != nil {
+		log.Errorf("Could not create summary file for %s: %s", recording, err.Error())
+		return summary
+	}
+	summaryFile.Close()
+	defer os.Remove(summaryFile.Name())
+
+	args := append([]string{"--no-tui", "--file=" + recording, "--batch-summary=" + summaryFile.Name()}, flags...)
+	if len(outputDir) > 0 {
+		args = append(args, "--output-dir="+outputDir)
+	}
+	if len(cli.CADUOut) > 0 {
+		args = append(args, "--cadu-out="+taggedPath(cli.CADUOut, name))
+	}
+	if len(cli.SoftSymbolsOut) > 0 {
+		args = append(args, "--soft-symbols-out="+taggedPath(cli.SoftSymbolsOut, name))
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = os.Stdout
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		log.Errorf("Could not start decoding %s: %s", recording, err.Error())
+		return summary
+	}
+	if len(outputDir) > 0 {
+		log.Infof("Decoding %s into %s", recording, outputDir)
+	} else {
+		log.Infof("Decoding %s", recording)
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		log.Errorf("Could not start decoding %s: %s", recording, err.Error())
+		return summary
+	}
+	jobs.add(cmd)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, scanner.Text())
+	}
+	err = cmd.Wait()
+	jobs.remove(cmd)
+	summary.Seconds = time.Since(start).Seconds()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		summary.RC = exitErr.ExitCode()
+	} else if err != nil {
+		log.Errorf("Could not decode %s: %s", recording, err.Error())
+		return summary
+	} else {
+		summary.RC = RC_SUCCESS
+	}
+	// A child that died before it finished does not leave a summary behind
+	if data, err := os.ReadFile(summaryFile.Name()); err == nil && len(data) > 0 {
+		rc := summary.RC
+		if err := json.Unmarshal(data, &summary); err != nil {
+			log.Errorf("Could not read the summary for %s: %s", recording, err.Error())
+		}
+		summary.RC = max(summary.RC, rc)
+	}
+	return summary
+}
+
+func printSummary(summaries []runSummary, total int, elapsed time.Duration) {
+	width := len("Recording")
+	for _, s := range summaries {
+		width = max(width, len(s.Recording))
+	}
+	fmt.Printf("%-*s %8s %8s %10s %10s %10s  %s\n", width, "Recording", "Files", "Failed", "Frames", "Dropped", "Time", "Result")
+	var ok, files, failed, frames int
+	for _, s := range summaries {
+		duration := time.Duration(s.Seconds * float64(time.Second)).Round(time.Second)
+		fmt.Printf("%-*s %8d %8d %10d %10d %10s  %s\n", width, s.Recording, s.FilesWritten, s.FilesFailed, s.Frames, s.DroppedPackets, duration, describeRC(s.RC))
+		if s.RC == RC_SUCCESS {
+			ok += 1
+		}
+		files += s.FilesWritten
+		failed += s.FilesFailed
+		frames += s.Frames
+	}
+	fmt.Printf("%d of %d recordings decoded without errors; %d LRIT files written (%d failed) from %d frames in %s\n", ok, total, files, failed, frames, elapsed.Round(time.Second))
+	if skipped := total - len(summaries); skipped > 0 {
+		fmt.Printf("%d recordings were not started\n", skipped)
+	}
+}
+
+func describeRC(rc int) string {
+	switch rc {
+	case RC_SUCCESS:
+		return "ok"
+	case RC_IO_ERROR:
+		return "failed"
+	case RC_WRITE_ERROR:
+		return "could not write some output"
+	case RC_INTERRUPTED:
+		return "interrupted"
+	}
+	return fmt.Sprintf("exit code %d", rc)
+}
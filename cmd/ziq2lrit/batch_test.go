@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputDirs(t *testing.T) {
+	recordings := []string{
+		filepath.Join("passes", "goes16.ziq"),
+		filepath.Join("archive", "goes16.ziq"),
+		"goes18.sigmf-meta",
+	}
+	names := recordingNames(recordings)
+	defer func(outputDir string, shared bool) {
+		cli.OutputDir, cli.SharedOutputDir = outputDir, shared
+	}(cli.OutputDir, cli.SharedOutputDir)
+
+	for _, tc := range []struct {
+		name      string
+		outputDir string
+		shared    bool
+		want      []string
+	}{
+		{"output dir", "out", false, []string{
+			filepath.Join("out", "goes16"),
+			filepath.Join("out", "goes16_2"),
+			filepath.Join("out", "goes18"),
+		}},
+		{"shared output dir", "out", true, []string{"out", "out", "out"}},
+		// Without --output-dir, nothing ends up in the working directory unless the recording is
+		{"next to each recording", "", false, []string{
+			filepath.Join("passes", "goes16"),
+			filepath.Join("archive", "goes16_2"),
+			"goes18",
+		}},
+		{"shared next to each recording", "", true, []string{"passes", "archive", "."}},
+	} {
+		cli.OutputDir, cli.SharedOutputDir = tc.outputDir, tc.shared
+		dirs := outputDirs(names)
+		for i, recording := range recordings {
+			if dirs[recording] != tc.want[i] {
+				t.Errorf("%s: %s goes to %q, want %q", tc.name, recording, dirs[recording], tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools"
+	"github.com/jrwynneiii/ccsds_tools/layers/datalink"
+	"github.com/jrwynneiii/ccsds_tools/layers/physical"
+	"github.com/jrwynneiii/ccsds_tools/layers/session"
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/ccsds_tools/pipeline"
+	"github.com/jrwynneiii/lrittools/config"
+	"github.com/jrwynneiii/lrittools/decoder"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+// A carrier pulled out of the input, decoded by a pipeline of its own into a directory of its own
+type channel struct {
+	offset float64
+	// Put in front of log lines and in file names, so channels can be told apart; empty when
+	// there is only one
+	label      string
+	tag        string
+	pipeline   *pipeline.Pipeline
+	feed       *decoder.Input
+	writer     *lritWriter
+	sessionOut *chan *lrit.File
+	demod      *physical.Demodulator
+	decode     *datalink.Decoder
+	cadus      *decoder.Tap
+	symbols    *decoder.Tap
+	// Closed once everything has made its way out of the session layer
+	drained chan struct{}
+	written int
+	failed  int
+}
+
+// Builds a pipeline for each of offsets. With more than one, each channel's files go in a
+// subdirectory of dir named after its offset, which is created if writeFiles is set
+func newChannels(options map[string]any, offsets []float64, dir string, writeFiles bool, metadata ziq.Metadata) ([]*channel, error) {
+	// When we have been told where the carriers are, the carrier search only has to look within
+	// the channel, and would otherwise pick up the channels either side
+	channelized := len(offsets) > 1 || offsets[0] != 0
+	seen := make(map[float64]bool)
+	var channels []*channel
+	for _, offset := range offsets {
+		if seen[offset] {
+			return nil, fmt.Errorf("Channel at %+.0f Hz given more than once", offset)
+		}
+		seen[offset] = true
+
+		channelOptions := maps.Clone(options)
+		channelOptions["channel.offset_hz"] = offset
+		if err := config.Derive(channelOptions); err != nil {
+			return nil, err
+		}
+		if channelized && channelOptions["carrier.max_offset_hz"].(float64) <= 0 {
+			channelOptions["carrier.max_offset_hz"] = channelOptions["channel.bandwidth_hz"].(float64) / 2
+		}
+
+		ch := channel{offset: offset, drained: make(chan struct{})}
+		channelDir := dir
+		if len(offsets) > 1 {
+			ch.label = fmt.Sprintf("%+.0f Hz: ", offset)
+			ch.tag = fmt.Sprintf("%+.0fHz", offset)
+			channelDir = filepath.Join(dir, ch.tag)
+			if writeFiles {
+				if err := os.MkdirAll(channelDir, 0755); err != nil {
+					return nil, fmt.Errorf("Could not create %s: %w", channelDir, err)
+				}
+			}
+		}
+		ch.writer = newLRITWriter(channelDir, metadata)
+
+		var err error
+		ch.pipeline, ch.feed, err = decoder.NewPipeline(channelOptions, ccsds_tools.PhysicalLayer, ccsds_tools.DataLinkLayer, ccsds_tools.TransportLayer, ccsds_tools.SessionLayer)
+		if err != nil {
+			return nil, fmt.Errorf("Could not start CCSDS pipeline: %w", err)
+		}
+		ch.sessionOut = ch.pipeline.Layers[ccsds_tools.SessionLayer].(*session.LRITGen).GetOutput().(*chan *lrit.File)
+		ch.demod = ch.pipeline.Layers[ccsds_tools.PhysicalLayer].(*physical.Demodulator)
+		ch.decode = ch.pipeline.Layers[ccsds_tools.DataLinkLayer].(*datalink.Decoder)
+		samplesPerSymbol := channelOptions["radio.sample_rate"].(float64) / channelOptions["xrit.symbol_rate"].(float64)
+		ch.writer.queued = func() int64 {
+			return ch.feed.Queued() + int64(float64(len(*ch.decode.SymbolsInput))*samplesPerSymbol)
+		}
+		if len(cli.CADUOut) > 0 {
+			if ch.cadus, err = decoder.TapFrames(ch.feed, ch.path(cli.CADUOut)); err != nil {
+				return nil, err
+			}
+		}
+		if len(cli.SoftSymbolsOut) > 0 {
+			if ch.symbols, err = decoder.TapSymbols(ch.feed, ch.path(cli.SoftSymbolsOut)); err != nil {
+				return nil, err
+			}
+		}
+		channels = append(channels, &ch)
+	}
+	return channels, nil
+}
+
+// Returns path, with the channel's offset added to the name when there is more than one channel
+func (ch *channel) path(path string) string {
+	if len(ch.tag) == 0 {
+		return path
+	}
+	return taggedPath(path, ch.tag)
+}
+
+// Closes the CADU and soft symbol files, returning whether they were written in full
+func (ch *channel) closeTaps() bool {
+	ok := true
+	for _, tap := range []*decoder.Tap{ch.cadus, ch.symbols} {
+		if tap == nil {
+			continue
+		}
+		if err := tap.Close(); err != nil {
+			log.Errorf("%s%s", ch.label, err.Error())
+			ok = false
+		}
+	}
+	if ch.cadus != nil {
+		log.Infof("%sWrote %d CADUs to %s", ch.label, ch.cadus.Count(), ch.cadus.Path())
+	}
+	if ch.symbols != nil {
+		log.Infof("%sWrote %d soft symbols to %s", ch.label, ch.symbols.Count(), ch.symbols.Path())
+	}
+	return ok
+}
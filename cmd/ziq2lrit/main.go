@@ -1,138 +1,398 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/charmbracelet/log"
-	"github.com/jrwynneiii/ccsds_tools"
-	"github.com/jrwynneiii/ccsds_tools/layers/datalink"
-	"github.com/jrwynneiii/ccsds_tools/layers/physical"
-	"github.com/jrwynneiii/ccsds_tools/layers/session"
 	"github.com/jrwynneiii/ccsds_tools/lrit"
-	"github.com/jrwynneiii/ccsds_tools/pipeline"
+	"github.com/jrwynneiii/lrittools/config"
+	"github.com/jrwynneiii/lrittools/decoder"
+	"github.com/jrwynneiii/lrittools/playback"
 	"github.com/jrwynneiii/lrittools/tui"
 	"github.com/jrwynneiii/lrittools/ziq"
 )
 
+const (
+	RC_SUCCESS     = 0
+	RC_IO_ERROR    = 1
+	RC_WRITE_ERROR = 2
+	// What a shell reports for a process killed by SIGINT
+	RC_INTERRUPTED = 130
+)
+
 var cli struct {
-	Verbose    bool    `help:"Prints debug output by default"`
-	File       string  `help:"Path to a ziq IQ file"`
-	OutputDir  string  `help:"Directory to output LRIT files"`
-	NoTui      bool    `help:"Disable the TUI and just use the cli"`
-	SampleRate float64 `help:"Sample rate of input ZIQ file"`
+	Verbose         bool          `help:"Prints debug output by default"`
+	Paths           []string      `arg:"" optional:"" help:"Recordings to decode one after another (or --jobs at a time): files, globs, or directories of recordings"`
+	File            string        `help:"Path to an IQ recording: ziq, wav, sigmf, or raw cs8/cs16/cf32/cu8. Use - to read raw samples from stdin" xor:"input"`
+	RTLTCP          string        `name:"rtltcp" help:"Address (host:port) of an rtl_tcp server to decode live" xor:"input"`
+	Frequency       float64       `help:"Frequency in Hz to tune the rtl_tcp server to; leaves it as it is by default"`
+	Format          string        `help:"Format of --file (ziq, wav, sigmf, cs8, cs16, cf32 or cu8); guessed from the file extension by default"`
+	OutputDir       string        `help:"Directory to output LRIT files"`
+	SharedOutputDir bool          `help:"Write the LRIT files from every recording straight into --output-dir, rather than a subdirectory for each"`
+	Jobs            int           `help:"Number of recordings to decode at once" default:"1"`
+	CADUOut         string        `name:"cadu-out" help:"Also write the frames that pass Reed-Solomon decoding to this file, as the 1024 byte CADUs (sync marker, derandomized frame and check symbols) SatDump and other CCSDS tools read"`
+	SoftSymbolsOut  string        `help:"Also write the demodulator's soft symbols to this file, one signed byte per symbol"`
+	NoTui           bool          `help:"Disable the TUI and just use the cli"`
+	SampleRate      float64       `help:"Sample rate of the input; read from the recording by default, and required for raw IQ files"`
+	Start           time.Duration `help:"Offset into the recording to start decoding from (e.g. 1h30m)"`
+	Duration        time.Duration `help:"Length of the recording to decode; defaults to the rest of the file"`
+	CenterOffsets   []float64     `name:"center-offset-hz" placeholder:"HZ" help:"Offset in Hz of the carrier from the center of a wideband recording; may be repeated to decode several carriers at once, each into its own subdirectory of --output-dir"`
+	Bandwidth       float64       `name:"channel-bandwidth" placeholder:"HZ" help:"Bandwidth in Hz to pull out around each carrier; just what the signal occupies by default"`
+	Realtime        bool          `help:"Feed the recording to the pipeline no faster than it was recorded, as if it were being received live. Playback can be paused with p in the TUI, or with SIGUSR1"`
+	Speed           string        `help:"Play the recording back at this multiple of real time (e.g. 2x or 0.5x); implies --realtime"`
+	Preset          string        `help:"Named set of demodulator and decoder settings for the downlink: goes-hrit, goes-lrit, or one from --presets-file" default:"goes-hrit"`
+	PresetsFile     string        `help:"JSON file of extra presets; defaults to presets.json in the lrittools user config directory (e.g. ~/.config/lrittools)"`
+	Config          string        `help:"Config file (HCL, JSON or YAML) with options to use over the preset"`
+	Set             []string      `help:"Set an option, over the preset and config file (e.g. --set xrit.pll_alpha=0.002); may be repeated" placeholder:"KEY=VALUE"`
+	DumpConfig      bool          `help:"Print the options that would be used as JSON, and exit"`
+	BatchSummary    string        `help:"Write a JSON summary of the run here; used by batch runs" hidden:""`
 }
 
-var options map[string]any = map[string]any{
-	"agc.gain":                      1.0,
-	"agc.max_gain":                  4000.0,
-	"agc.rate":                      0.01,
-	"agc.reference":                 0.5,
-	"clockrecovery.alpha":           0.0037,
-	"clockrecovery.mu":              0.5,
-	"clockrecovery.omega_limit":     0.005,
-	"tui.enable_log_output":         true,
-	"tui.refresh_ms":                500,
-	"tui.rs_threshold_crit_pct":     5.0,
-	"tui.rs_threshold_warn_pct":     2.0,
-	"tui.vit_threshold_crit_pct":    5.0,
-	"tui.vit_threshold_warn_pct":    3.0,
-	"viterbi.max_errors":            500,
-	"xrit.chunk_size":               66560,
-	"xrit.decimation_factor":        1,
-	"xrit.do_fft":                   true,
-	"xrit.lowpass_transition_width": 200000.0,
-	"xrit.pll_alpha":                0.001,
-	"xrit.rrc_alpha":                0.3,
-	"xrit.rrc_taps":                 31,
-	"xrit.symbol_rate":              927000.0,
-	"xritframe.frame_size":          1024,
-	"xritframe.last_frame_size":     8,
-}
+var options map[string]any = config.Defaults()
 
 func main() {
-	_ = kong.Parse(&cli)
+	parsed := kong.Parse(&cli)
 	if cli.Verbose {
 		log.SetLevel(log.DebugLevel)
 	}
 
-	options["radio.sample_rate"] = 2048000.0
-	if cli.SampleRate != 0 {
-		options["radio.sample_rate"] = cli.SampleRate
+	if err := loadOptions(options); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if cli.Bandwidth != 0 {
+		options["channel.bandwidth_hz"] = cli.Bandwidth
+	}
+	if len(cli.CenterOffsets) == 1 {
+		options["channel.offset_hz"] = cli.CenterOffsets[0]
+	}
+	if cli.DumpConfig && len(cli.File) == 0 {
+		if cli.SampleRate != 0 {
+			options["radio.sample_rate"] = cli.SampleRate
+		}
+		dumpConfig(options)
+		return
+	}
+
+	if len(cli.Paths) > 0 {
+		if len(cli.File) > 0 || len(cli.RTLTCP) > 0 {
+			log.Fatalf("Recordings can not be given along with --file or --rtltcp")
+		}
+		recordings, err := findRecordings(cli.Paths)
+		if err != nil {
+			log.Fatalf("%s", err.Error())
+		}
+		if len(recordings) > 1 {
+			if cli.Jobs < 1 {
+				log.Fatalf("--jobs must be at least 1")
+			}
+			os.Exit(runBatch(recordings, childArgs(parsed.Model.Flags)))
+		}
+		cli.File = recordings[0]
+	}
+
+	var output ziq.SampleSource
+	var err error
+	input := cli.File
+	if len(cli.File) == 0 && len(cli.RTLTCP) == 0 {
+		log.Fatalf("One of --file or --rtltcp is required")
+	} else if len(cli.RTLTCP) > 0 {
+		input = cli.RTLTCP
+		if cli.SampleRate != 0 {
+			options["radio.sample_rate"] = cli.SampleRate
+		}
+		output, err = ziq.DialRTLTCP(cli.RTLTCP, options["radio.sample_rate"].(float64), cli.Frequency)
+	} else {
+		output, err = ziq.Open(cli.File, cli.Format, cli.SampleRate)
+	}
+	if err != nil {
+		log.Fatalf("Could not open %s: %s", input, err.Error())
+	}
+	defer output.Close()
+
+	metadata, err := output.Metadata()
+	if err != nil {
+		log.Warnf("%s; continuing without recording metadata", err.Error())
+	}
+	log.Infof("Recording: format %s, sample rate %.0f, frequency %.0f Hz, start time %s, source %q", metadata.Format, metadata.SampleRate, metadata.Frequency, metadata.StartTime, metadata.Source)
+	if metadata.AnnotatedSampleRate != 0 && metadata.AnnotatedSampleRate != metadata.SampleRate {
+		log.Warnf("Annotated sample rate (%.0f) does not match the header sample rate (%.0f)", metadata.AnnotatedSampleRate, metadata.SampleRate)
 	}
 
+	// The recording knows its own sample rate; --sample-rate is only needed for raw files, or to
+	// override a header that is wrong
+	sampleRate := output.SampleRate()
+	if cli.SampleRate != 0 && sampleRate != 0 && cli.SampleRate != sampleRate {
+		log.Warnf("--sample-rate %.0f does not match the %.0f samples/s of %s; demodulating at %.0f samples/s anyway", cli.SampleRate, sampleRate, input, cli.SampleRate)
+		sampleRate = cli.SampleRate
+	} else if sampleRate == 0 && cli.SampleRate != 0 {
+		sampleRate = cli.SampleRate
+	} else if sampleRate == 0 {
+		sampleRate = options["radio.sample_rate"].(float64)
+		log.Warnf("%s does not say what its sample rate is; assuming %.0f samples/s. Use --sample-rate to set it", input, sampleRate)
+	}
+	options["radio.sample_rate"] = sampleRate
+	if err := config.Derive(options); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if cli.DumpConfig {
+		dumpConfig(options)
+		return
+	}
+	decimation := options["xrit.decimation_factor"].(int)
+	log.Infof("Demodulating at %.0f samples/s, decimated by %d to %.2f samples per symbol", sampleRate, decimation, sampleRate/float64(decimation)/options["xrit.symbol_rate"].(float64))
+
 	xritChunkSize := options["xrit.chunk_size"].(int)
 	log.Debugf("Starting CCSDS pipeline")
 
-	pipeline := pipeline.NewWithOptionsMap(options)
-	pipeline.Register(ccsds_tools.PhysicalLayer)
-	pipeline.Register(ccsds_tools.DataLinkLayer)
-	pipeline.Register(ccsds_tools.TransportLayer)
-	pipeline.Register(ccsds_tools.SessionLayer)
+	// The TUI always lists the files, but only writes them out if asked to
+	writeFiles := cli.NoTui || len(cli.OutputDir) > 0
+	offsets := cli.CenterOffsets
+	if len(offsets) == 0 {
+		offsets = []float64{options["channel.offset_hz"].(float64)}
+	}
+	channels, err := newChannels(options, offsets, cli.OutputDir, writeFiles, metadata)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if len(offsets) > 1 || offsets[0] != 0 {
+		for _, ch := range channels {
+			log.Infof("Pulling out %.0f Hz around the carrier at %+.0f Hz", options["channel.bandwidth_hz"].(float64), ch.offset)
+		}
+	}
+	inputs := make([]*decoder.Input, len(channels))
+	for i, ch := range channels {
+		inputs[i] = ch.feed
+	}
+	feed := decoder.NewSplitter(inputs...)
 
-	sessionOut := pipeline.Layers[ccsds_tools.SessionLayer].(*session.LRITGen).GetOutput().(*chan *lrit.File)
-	samplesIn := pipeline.Layers[ccsds_tools.PhysicalLayer].GetInput().(*chan []complex64)
-	demod := pipeline.Layers[ccsds_tools.PhysicalLayer].(*physical.Demodulator)
-	decode := pipeline.Layers[ccsds_tools.DataLinkLayer].(*datalink.Decoder)
+	if cli.Start > 0 {
+		if err := output.SeekTime(cli.Start); err != nil {
+			log.Fatalf("Could not seek to %s: %s", cli.Start, err.Error())
+		}
+	}
+
+	// A negative count means we read to the end of the recording
+	remaining := int64(-1)
+	if cli.Duration > 0 {
+		if sampleRate == 0 {
+			log.Fatalf("Can not stop after --duration %s; %s has no sample rate", cli.Duration, input)
+		}
+		remaining = int64(cli.Duration.Seconds() * sampleRate)
+	}
 
-	output := ziq.Load(cli.File)
-	if output == nil {
-		log.Fatalf("File %s is not a valid ZIQ file", cli.File)
-		os.Exit(1)
+	// Recordings can be paused, and paced to the rate they were recorded at. Live input comes at
+	// its own pace
+	var pacer *playback.Pacer
+	live := len(cli.RTLTCP) > 0 || cli.File == "-"
+	if live && (cli.Realtime || len(cli.Speed) > 0) {
+		log.Warnf("%s is already live; ignoring --realtime and --speed", input)
+	} else if !live {
+		pacer = playback.NewPacer(sampleRate)
+		speed, err := playbackSpeed()
+		if err != nil {
+			log.Fatalf("%s", err.Error())
+		}
+		pacer.SetSpeed(speed)
+		if speed > 0 {
+			log.Infof("Playing %s back at %gx real time", input, speed)
+		}
+	}
+
+	// Closed to stop reading early, on a signal or when the TUI is quit. Either way, whatever is
+	// already in the pipeline is still decoded and written out
+	stopReading := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() { close(stopReading) })
+		// A paused reader would never get to see that it has been stopped
+		if pacer != nil {
+			pacer.Resume()
+		}
+	}
+	var interrupted atomic.Bool
+	signals := make(chan os.Signal, 2)
+	if len(cli.BatchSummary) > 0 {
+		// In a batch run, Ctrl-C is left to the batch, which sends us SIGTERM and kills us if it
+		// wants us gone any sooner
+		signal.Ignore(syscall.SIGINT)
+		signal.Notify(signals, syscall.SIGTERM)
+	} else {
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	}
-	log.Debugf("ZIQ Header: %##v", output.Header)
 	go func() {
-		for !output.Done {
-			chunk := output.GetNextChunk(int(xritChunkSize))
-			*samplesIn <- chunk
+		sig := <-signals
+		log.Warnf("Got %s; finishing the files already in the pipeline. Send it again to quit now", sig)
+		interrupted.Store(true)
+		stop()
+		if len(cli.BatchSummary) > 0 {
+			return
 		}
-		log.Infof("Finished reading ZIQ file")
+		sig = <-signals
+		log.Errorf("Got %s again; quitting without finishing", sig)
+		os.Exit(RC_INTERRUPTED)
 	}()
-
-	pipeline.Start()
-
-	defer pipeline.Destroy()
-
-	var wg sync.WaitGroup
-	if cli.NoTui {
+	if pacer != nil && cli.NoTui && len(pauseSignals) > 0 {
+		pauses := make(chan os.Signal, 1)
+		signal.Notify(pauses, pauseSignals...)
 		go func() {
-			for {
-				select {
-				case f := <-*sessionOut:
-					log.Infof("Got LRIT file (Version: %d, VCDUVersion: %d) with primary header: %##v, and secondary headers: %##v", f.Version, f.VCDUVersion, f.PrimaryHeader, f.SecondaryHeaders)
-					f.WriteFile(cli.OutputDir)
-				default:
-					time.Sleep(50 * time.Millisecond)
+			for range pauses {
+				if pacer.TogglePause() {
+					log.Infof("Paused playback of %s", input)
+				} else {
+					log.Infof("Resumed playback of %s", input)
 				}
 			}
 		}()
 	}
 
+	started := time.Now()
+	for _, ch := range channels {
+		ch.writer.position.Store(output.Position())
+	}
+	var readErr error
+	readDone := make(chan struct{})
 	go func() {
-		wg.Add(1)
-		emptyCounter := 0
-		for {
-			time.Sleep(5 * time.Second)
-			if len(*samplesIn) > 0 {
-				log.Infof("Locked: %v\tCurrent SNR: %f\tDecoded Packets: %v\tDropped packets: %v", decode.FrameLock, demod.CurrentSNR, decode.RxPacketsPerChannel, decode.DroppedPacketsPerChannel)
-				log.Infof("Buffers: samplesIn: %d, transportOut: %d", len(*samplesIn), len(*sessionOut))
+		defer close(readDone)
+		// The pipeline copies what it needs, so chunks go straight back to the reader
+		reader := ziq.StartReadAhead(output, xritChunkSize, 8)
+		defer reader.Close()
+	read:
+		for remaining != 0 {
+			select {
+			case <-stopReading:
+				log.Infof("Stopped reading %s", input)
+				break read
+			default:
 			}
-
-			if len(*samplesIn) == 0 {
-				emptyCounter += 1
-				if emptyCounter > 2 {
-					pipeline.Flush()
-					pipeline.Destroy()
-					break
+			chunk, err := reader.Next()
+			if err == io.EOF {
+				log.Infof("Finished reading %s", input)
+				break
+			} else if err != nil {
+				log.Errorf("Could not read %s: %s", input, err.Error())
+				readErr = err
+				break
+			}
+			if remaining > 0 {
+				chunk = chunk[:min(int64(len(chunk)), remaining)]
+				remaining -= int64(len(chunk))
+			}
+			if len(chunk) > 0 {
+				if pacer != nil {
+					pacer.Wait(len(chunk))
+				}
+				n := int64(len(chunk))
+				feed.Write(chunk)
+				for _, ch := range channels {
+					ch.writer.position.Add(n)
 				}
 			}
+			reader.Release(chunk)
 		}
-		wg.Done()
+		feed.Flush()
 	}()
 
+	for _, ch := range channels {
+		ch.pipeline.Start()
+	}
+
+	// Once the reader is done, wait for the rest of the input to make its way out of the session
+	// layer of every pipeline
+	drained := make(chan struct{})
+	go func() {
+		<-readDone
+		log.Debugf("Draining CCSDS pipeline")
+		var drains sync.WaitGroup
+		for _, ch := range channels {
+			drains.Add(1)
+			go func() {
+				defer drains.Done()
+				if err := ch.feed.Drain(decoder.DefaultDrainTimeout); err != nil {
+					log.Warnf("%s%s", ch.label, err.Error())
+				}
+				close(ch.drained)
+			}()
+		}
+		drains.Wait()
+		close(drained)
+	}()
+
+	var tuiFiles chan *lrit.File
 	if !cli.NoTui {
+		tuiFiles = make(chan *lrit.File, 64)
+	}
+
+	handleFile := func(ch *channel, f *lrit.File) {
+		if cli.NoTui {
+			log.Infof("%sGot LRIT file (Version: %d, VCDUVersion: %d) with primary header: %##v, and secondary headers: %##v", ch.label, f.Version, f.VCDUVersion, f.PrimaryHeader, f.SecondaryHeaders)
+			if rxTime, ok := ch.writer.receptionTime(); ok {
+				log.Infof("%sLRIT file %s received at %s", ch.label, f.GetName(), rxTime.Format(time.RFC3339))
+			}
+		}
+		if writeFiles {
+			if err := ch.writer.Write(f); err != nil {
+				log.Errorf("%s%s", ch.label, err.Error())
+				ch.failed += 1
+			} else {
+				ch.written += 1
+			}
+		}
+		if tuiFiles != nil {
+			tuiFiles <- f
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, ch := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case f := <-*ch.sessionOut:
+					handleFile(ch, f)
+				case <-ch.drained:
+					// Nothing more is coming out of the session layer, so this is the last of it
+					for len(*ch.sessionOut) > 0 {
+						handleFile(ch, <-*ch.sessionOut)
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	if cli.NoTui {
+		go func() {
+			for {
+				select {
+				case <-time.After(5 * time.Second):
+					for _, ch := range channels {
+						ch.decode.StatsMutex.RLock()
+						log.Infof("%sLocked: %v\tCurrent SNR: %f\tDecoded Packets: %v\tDropped packets: %v", ch.label, ch.decode.FrameLock, ch.demod.CurrentSNR, ch.decode.RxPacketsPerChannel, ch.decode.DroppedPacketsPerChannel)
+						ch.decode.StatsMutex.RUnlock()
+						log.Infof("%sBuffers: queued samples: %d, sessionOut: %d", ch.label, ch.feed.Queued(), len(*ch.sessionOut))
+						if offset, found := ch.feed.CarrierOffset(); found {
+							log.Infof("%sCarrier offset: %+.0f Hz", ch.label, offset)
+						}
+					}
+				case <-drained:
+					return
+				}
+			}
+		}()
+	} else {
 		tuiDef := tui.TuiConf{
 			RefreshMs:           options["tui.refresh_ms"].(int),
 			RsThresholdWarnPct:  options["tui.rs_threshold_warn_pct"].(float64),
@@ -141,12 +401,120 @@ func main() {
 			VitThresholdCritPct: options["tui.vit_threshold_crit_pct"].(float64),
 			EnableLogOutput:     options["tui.enable_log_output"].(bool),
 		}
+		go func() {
+			<-drained
+			log.Infof("Finished decoding %s; press q to quit", input)
+		}()
+
+		// The TUI has room for one demodulator, but lists the files from every channel
+		shown := channels[0]
+		if len(channels) > 1 {
+			log.Infof("Showing the lock and signal of the channel at %+.0f Hz; the others are decoded all the same", shown.offset)
+		}
+		// The TUI stops on q, or once a signal comes in
+		tui.StartZiq2LRITUI(shown.feed, shown.decode, shown.demod, pacer, tuiFiles, stopReading, tuiDef)
+		stop()
+	}
 
-		tui.StartZiq2LRITUI(pipeline, decode, demod, cli.OutputDir, tuiDef)
+	wg.Wait()
+	if tuiFiles != nil {
+		close(tuiFiles)
 	}
 
-	time.Sleep(1 * time.Second)
-	if cli.NoTui {
-		wg.Wait()
+	var written, failed int
+	tapsOk := true
+	for _, ch := range channels {
+		ch.pipeline.Destroy()
+		if !ch.closeTaps() {
+			tapsOk = false
+		}
+		if writeFiles {
+			log.Infof("%sWrote %d LRIT files to %s", ch.label, ch.written, ch.writer.dir)
+		}
+		written += ch.written
+		failed += ch.failed
+	}
+	rc := RC_SUCCESS
+	if interrupted.Load() {
+		rc = RC_INTERRUPTED
+	} else if readErr != nil {
+		rc = RC_IO_ERROR
+	} else if failed > 0 {
+		log.Errorf("Could not write %d LRIT files", failed)
+		rc = RC_WRITE_ERROR
+	} else if !tapsOk {
+		rc = RC_WRITE_ERROR
+	}
+	if len(cli.BatchSummary) > 0 {
+		summary := runSummary{
+			Recording:    input,
+			OutputDir:    cli.OutputDir,
+			FilesWritten: written,
+			FilesFailed:  failed,
+			Seconds:      time.Since(started).Seconds(),
+			RC:           rc,
+		}
+		for _, ch := range channels {
+			ch.decode.StatsMutex.RLock()
+			summary.Frames += ch.decode.TotalFramesProcessed
+			for _, dropped := range ch.decode.DroppedPacketsPerChannel {
+				summary.DroppedPackets += dropped
+			}
+			ch.decode.StatsMutex.RUnlock()
+		}
+		if err := summary.write(cli.BatchSummary); err != nil {
+			log.Errorf("Could not write summary to %s: %s", cli.BatchSummary, err.Error())
+		}
+	}
+	output.Close()
+	os.Exit(rc)
+}
+
+// Returns how many times faster than real time to play the recording back, or 0 to decode it as
+// fast as we can
+func playbackSpeed() (float64, error) {
+	if len(cli.Speed) == 0 {
+		if cli.Realtime {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(cli.Speed)), "x"), 64)
+	if err != nil || !(speed > 0) || math.IsInf(speed, 1) {
+		return 0, fmt.Errorf("Invalid --speed %s; give a multiple of real time such as 2x or 0.5x", cli.Speed)
+	}
+	return speed, nil
+}
+
+// Sets up options from --preset, then --config, then --set
+func loadOptions(options map[string]any) error {
+	presets, err := config.LoadPresets(cli.PresetsFile)
+	if err != nil {
+		return err
+	}
+	if err := presets.Apply(cli.Preset, options); err != nil {
+		return err
+	}
+	if len(cli.Config) > 0 {
+		if err := config.LoadFile(options, cli.Config); err != nil {
+			return err
+		}
+	}
+	for _, assignment := range cli.Set {
+		if err := config.SetString(options, assignment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpConfig(options map[string]any) {
+	if err := config.Derive(options); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	data, err := config.Dump(options)
+	if err != nil {
+		log.Fatalf("Could not encode config: %s", err.Error())
 	}
+	fmt.Println(string(data))
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools/lrit"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+// Writes decoded LRIT files to a directory, stamping each file's modification time with the
+// time it was received, when the recording metadata tells us when it started
+type lritWriter struct {
+	dir      string
+	metadata ziq.Metadata
+	// Number of samples handed to the pipeline so far
+	position atomic.Int64
+	// Returns how many of those samples are still queued up in front of the decoder
+	queued      func() int64
+	counterLock sync.Mutex
+	counter     map[string]int
+}
+
+func newLRITWriter(dir string, metadata ziq.Metadata) *lritWriter {
+	return &lritWriter{
+		dir:      dir,
+		metadata: metadata,
+		counter:  make(map[string]int),
+	}
+}
+
+// Returns the reception time of a file that comes out of the pipeline now. Whatever is still
+// queued up in front of the demodulator and decoder was received after it
+func (w *lritWriter) receptionTime() (time.Time, bool) {
+	position := w.position.Load()
+	if w.queued != nil {
+		position = max(position-w.queued(), 0)
+	}
+	return w.metadata.SampleTime(position)
+}
+
+func (w *lritWriter) Write(f *lrit.File) error {
+	// Follows the same naming as lrit.File.WriteFile
+	w.counterLock.Lock()
+	path := filepath.Join(w.dir, f.GetName())
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		path = filepath.Join(w.dir, fmt.Sprintf("%s_%d_%d", f.GetName(), f.VCDUVersion, w.counter[f.GetName()]))
+		w.counter[f.GetName()] += 1
+	}
+	w.counterLock.Unlock()
+
+	if err := os.WriteFile(path, f.RawData, os.FileMode(0644)); err != nil {
+		return fmt.Errorf("Could not write file %s: %w", path, err)
+	}
+
+	if rxTime, ok := w.receptionTime(); ok {
+		if err := os.Chtimes(path, rxTime, rxTime); err != nil {
+			log.Warnf("Could not set reception time on %s: %s", path, err.Error())
+		}
+	}
+	return nil
+}
+
+// Returns path with tag added to the end of its name, ahead of the extension
+func taggedPath(path, tag string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + tag + ext
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// There is no SIGUSR1 to pause playback with here; the TUI can still do it
+var pauseSignals = []os.Signal{}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals that pause and resume playback of a recording
+var pauseSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/iqdsp"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+const (
+	RC_SUCCESS     = 0
+	RC_IO_ERROR    = 1
+	RC_INVALID_ZIQ = 2
+)
+
+var cli struct {
+	Verbose bool     `help:"Prints debug output by default"`
+	Paths   []string `arg:"" help:"Path to a ziq IQ file" sep:" "`
+	Json    bool     `help:"Print one JSON object per file instead of a text report"`
+	Bins    int      `help:"Number of bins in the sample magnitude histogram" default:"16"`
+	Index   bool     `help:"Write the zstd frame index of each compressed file next to it as <file>.zidx, so later seeks into it start straight away"`
+}
+
+type report struct {
+	Path             string        `json:"path"`
+	Header           ziq.ZiqHeader `json:"header"`
+	Metadata         ziq.Metadata  `json:"metadata"`
+	AnnotationError  string        `json:"annotation_error,omitempty"`
+	NumSamples       int64         `json:"num_samples"`
+	DurationSeconds  float64       `json:"duration_seconds"`
+	BodyBytes        int64         `json:"body_bytes"`
+	CompressionRatio float64       `json:"compression_ratio"`
+	// Set when the body ends partway through a sample
+	Truncated bool          `json:"truncated"`
+	Stats     iqdsp.Summary `json:"stats"`
+}
+
+func main() {
+	_ = kong.Parse(&cli)
+	if cli.Verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	var rc int = 0
+	for _, path := range cli.Paths {
+		ret := ziqInfo(path)
+		if ret > rc {
+			rc = ret
+		}
+	}
+	os.Exit(rc)
+}
+
+func ziqInfo(path string) int {
+	z, err := ziq.Load(path)
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		log.Errorf("Could not read file %s: %s", path, err.Error())
+		return RC_IO_ERROR
+	} else if err != nil {
+		log.Errorf("File %s is not a valid ZIQ file: %s", path, err.Error())
+		return RC_INVALID_ZIQ
+	}
+	defer z.Close()
+
+	r := report{Path: path, Header: z.Header}
+	if r.Metadata, err = z.Metadata(); err != nil {
+		r.AnnotationError = err.Error()
+	}
+	if r.BodyBytes, err = z.BodySize(); err != nil {
+		log.Errorf("Could not read file %s: %s", path, err.Error())
+		return RC_IO_ERROR
+	}
+
+	rc := RC_SUCCESS
+	stats := iqdsp.NewStats(cli.Bins)
+	reader := ziq.StartReadAhead(z, 66560, 8)
+	for {
+		samples, err := reader.Next()
+		stats.Add(samples)
+		reader.Release(samples)
+		if err == io.EOF {
+			break
+		} else if errors.Is(err, ziq.ErrTruncated) {
+			r.Truncated = true
+			rc = RC_INVALID_ZIQ
+			break
+		} else if err != nil {
+			log.Errorf("Could not read file %s: %s", path, err.Error())
+			reader.Close()
+			return RC_IO_ERROR
+		}
+	}
+	reader.Close()
+
+	if cli.Index && z.Header.Compressed {
+		if err := z.WriteFrameIndex(); err != nil {
+			log.Errorf("Could not index %s: %s", path, err.Error())
+			rc = max(rc, RC_IO_ERROR)
+		}
+	}
+
+	r.NumSamples = stats.Count
+	if z.Header.SampleRate > 0 {
+		r.DurationSeconds = float64(r.NumSamples) / float64(z.Header.SampleRate)
+	}
+	if r.BodyBytes > 0 {
+		r.CompressionRatio = float64(r.NumSamples*int64(r.Metadata.Format.SampleSize())) / float64(r.BodyBytes)
+	}
+	r.Stats = stats.Summary()
+
+	if cli.Json {
+		data, err := json.Marshal(r)
+		if err != nil {
+			log.Errorf("Could not encode report for %s: %s", path, err.Error())
+			return RC_IO_ERROR
+		}
+		fmt.Println(string(data))
+	} else {
+		printReport(r)
+	}
+	return rc
+}
+
+func printReport(r report) {
+	h := r.Header
+	fmt.Printf("%s:\n", r.Path)
+	fmt.Printf("Header:\n")
+	fmt.Printf("  Compressed:        %v\n", h.Compressed)
+	fmt.Printf("  Format:            %s (%d bits per sample)\n", r.Metadata.Format, h.BitsPerSample)
+	fmt.Printf("  Sample rate:       %d\n", h.SampleRate)
+	fmt.Printf("  Annotation:        %d bytes\n", h.AnnotationLength)
+
+	fmt.Printf("Annotation:\n")
+	if len(r.AnnotationError) > 0 {
+		fmt.Printf("  %s\n", r.AnnotationError)
+	}
+	if r.Metadata.Frequency != 0 {
+		fmt.Printf("  Frequency:         %.0f Hz\n", r.Metadata.Frequency)
+	}
+	if r.Metadata.AnnotatedSampleRate != 0 {
+		fmt.Printf("  Sample rate:       %.0f\n", r.Metadata.AnnotatedSampleRate)
+	}
+	if !r.Metadata.StartTime.IsZero() {
+		fmt.Printf("  Start time:        %s\n", r.Metadata.StartTime.Format(time.RFC3339Nano))
+	}
+	if len(r.Metadata.Source) > 0 {
+		fmt.Printf("  Source:            %s\n", r.Metadata.Source)
+	}
+	for _, key := range slices.Sorted(maps.Keys(r.Metadata.Raw)) {
+		value := r.Metadata.Raw[key]
+		// JSON numbers are all floats; print them without an exponent
+		if f, ok := value.(float64); ok {
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		fmt.Printf("  %-18s %v\n", key+":", value)
+	}
+
+	duration := time.Duration(r.DurationSeconds * float64(time.Second))
+	s := r.Stats
+	fmt.Printf("Body:\n")
+	fmt.Printf("  Samples:           %d\n", r.NumSamples)
+	fmt.Printf("  Duration:          %s\n", duration.Round(time.Millisecond))
+	fmt.Printf("  Size:              %d bytes\n", r.BodyBytes)
+	fmt.Printf("  Compression ratio: %.2f\n", r.CompressionRatio)
+	if r.Truncated {
+		fmt.Printf("  Truncated:         body ends partway through a sample\n")
+	}
+
+	fmt.Printf("Signal:\n")
+	fmt.Printf("  DC offset:         %+.5f %+.5fj\n", s.DCOffsetI, s.DCOffsetQ)
+	fmt.Printf("  I/Q imbalance:     %+.3f dB\n", s.IQImbalanceDB)
+	fmt.Printf("  I/Q phase error:   %+.3f degrees\n", s.IQPhaseDeg)
+	fmt.Printf("  RMS power:         %.5f (%.2f dBFS)\n", s.RMS, s.RMSdBFS)
+	fmt.Printf("  Clipping:          %.4f%%\n", s.ClippedPercent)
+
+	fmt.Printf("Magnitude histogram:\n")
+	var largest int64
+	for _, bin := range s.Histogram {
+		largest = max(largest, bin.Count)
+	}
+	for _, bin := range s.Histogram {
+		width := 0
+		if largest > 0 {
+			width = int(40 * bin.Count / largest)
+		}
+		fmt.Printf("  %.3f-%.3f %12d %s\n", bin.Low, bin.High, bin.Count, strings.Repeat("#", width))
+	}
+	fmt.Printf("\n")
+}
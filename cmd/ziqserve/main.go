@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/playback"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+var cli struct {
+	Verbose bool   `help:"Prints debug output by default"`
+	File    string `arg:"" help:"Path to a ziq IQ file"`
+	Listen  string `help:"Address to listen for rtl_tcp clients on" default:"127.0.0.1:1234"`
+	Loop    bool   `help:"Start the recording over when it ends, instead of disconnecting the client and exiting"`
+}
+
+// What we claim to be in the dongle info header: an R820T tuner with its 29 gain steps
+const (
+	tunerR820T   = 5
+	r820tGains   = 29
+	rtltcpCmdLen = 5
+)
+
+var rtltcpCommands = map[byte]string{
+	0x01: "set frequency",
+	0x02: "set sample rate",
+	0x03: "set gain mode",
+	0x04: "set gain",
+	0x05: "set frequency correction",
+	0x06: "set IF gain",
+	0x07: "set test mode",
+	0x08: "set AGC mode",
+	0x09: "set direct sampling",
+	0x0a: "set offset tuning",
+	0x0d: "set gain by index",
+	0x0e: "set bias tee",
+}
+
+func main() {
+	_ = kong.Parse(&cli)
+	if cli.Verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	input, err := ziq.Load(cli.File)
+	if err != nil {
+		log.Fatalf("File %s is not a valid ZIQ file: %s", cli.File, err.Error())
+	}
+	sampleRate := input.SampleRate()
+	input.Close()
+	if sampleRate == 0 {
+		log.Fatalf("ZIQ header has no sample rate; can not play it back in real time")
+	}
+
+	listener, err := net.Listen("tcp", cli.Listen)
+	if err != nil {
+		log.Fatalf("Could not listen on %s: %s", cli.Listen, err.Error())
+	}
+	defer listener.Close()
+	log.Infof("Serving %s at %.0f samples/s on %s", cli.File, sampleRate, listener.Addr())
+
+	// rtl_tcp only serves one client at a time; others wait in the listen backlog
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatalf("Could not accept connection: %s", err.Error())
+		}
+		log.Infof("Client %s connected", conn.RemoteAddr())
+		finished := serve(conn)
+		conn.Close()
+		if finished {
+			log.Infof("Finished playing %s to %s", cli.File, conn.RemoteAddr())
+			return
+		}
+		log.Infof("Client %s disconnected", conn.RemoteAddr())
+	}
+}
+
+// Plays the recording to a client from the start. Returns true once the whole recording has been
+// sent, or false if the client went away first
+func serve(conn net.Conn) bool {
+	input, err := ziq.Load(cli.File)
+	if err != nil {
+		log.Errorf("Could not reopen %s: %s", cli.File, err.Error())
+		return false
+	}
+	defer input.Close()
+
+	header := []byte("RTL0\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint32(header[4:8], tunerR820T)
+	binary.BigEndian.PutUint32(header[8:12], r820tGains)
+	if _, err := conn.Write(header); err != nil {
+		log.Errorf("Could not send header to %s: %s", conn.RemoteAddr(), err.Error())
+		return false
+	}
+	go readCommands(conn)
+
+	writer, err := ziq.NewRawWriter(conn, ziq.CU8)
+	if err != nil {
+		log.Errorf("%s", err.Error())
+		return false
+	}
+	// Send about 10ms of samples at a time, so slow recordings do not look stalled to the client
+	chunkSize := max(int(input.SampleRate()/100), 1)
+	pacer := playback.NewPacer(input.SampleRate())
+	reader := ziq.StartReadAhead(input, chunkSize, 8)
+	defer func() {
+		reader.Close()
+	}()
+	for {
+		samples, err := reader.Next()
+		if len(samples) > 0 {
+			pacer.Wait(len(samples))
+			if err := writer.WriteSamples(samples); err != nil {
+				log.Debugf("Could not write to %s: %s", conn.RemoteAddr(), err.Error())
+				return false
+			}
+		}
+		reader.Release(samples)
+
+		if err == io.EOF && cli.Loop {
+			log.Infof("Reached the end of %s; starting over", cli.File)
+			reader.Close()
+			if _, err := input.Seek(0, io.SeekStart); err != nil {
+				log.Errorf("Could not seek back to the start of %s: %s", cli.File, err.Error())
+				return false
+			}
+			reader = ziq.StartReadAhead(input, chunkSize, 8)
+		} else if err == io.EOF {
+			return true
+		} else if err != nil {
+			log.Errorf("Could not read %s: %s", cli.File, err.Error())
+			return false
+		}
+	}
+}
+
+// Reads and ignores tuning commands from the client; the recording is what it is
+func readCommands(conn net.Conn) {
+	cmd := make([]byte, rtltcpCmdLen)
+	for {
+		if _, err := io.ReadFull(conn, cmd); err != nil {
+			return
+		}
+		name, ok := rtltcpCommands[cmd[0]]
+		if !ok {
+			name = "unknown command"
+		}
+		log.Debugf("Ignoring rtl_tcp %s (0x%02x) with parameter %d from %s", name, cmd[0], binary.BigEndian.Uint32(cmd[1:]), conn.RemoteAddr())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+var cli struct {
+	Verbose         bool          `help:"Prints debug output by default"`
+	File            string        `arg:"" help:"Path to a ziq IQ file"`
+	OutputDir       string        `help:"Directory to write the segments to; defaults to the directory of the input file"`
+	SegmentDuration time.Duration `help:"Split the recording into segments of this length (e.g. 10m); by default a single segment is written"`
+	Start           time.Duration `help:"Offset into the recording to start from (e.g. 1m30s)"`
+	End             time.Duration `help:"Offset into the recording to stop at; defaults to the end of the file"`
+}
+
+func main() {
+	_ = kong.Parse(&cli)
+	if cli.Verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	if cli.End > 0 && cli.End <= cli.Start {
+		log.Fatalf("--end (%s) must come after --start (%s)", cli.End, cli.Start)
+	}
+	if cli.SegmentDuration == 0 && cli.Start == 0 && cli.End == 0 {
+		log.Fatalf("Nothing to do; give --segment-duration, --start or --end")
+	}
+
+	input, err := ziq.Load(cli.File)
+	if err != nil {
+		log.Fatalf("File %s is not a valid ZIQ file: %s", cli.File, err.Error())
+	}
+	defer input.Close()
+	sampleRate := input.SampleRate()
+	if sampleRate == 0 {
+		log.Fatalf("ZIQ header has no sample rate; can not split by time")
+	}
+
+	// Segments of segments are still offset from the start of the original recording
+	var baseOffset int64
+	if metadata, err := input.Metadata(); err == nil {
+		if offset, ok := metadata.Raw[ziq.SegmentOffsetSamplesKey].(float64); ok {
+			baseOffset = int64(offset)
+		}
+	}
+
+	if cli.Start > 0 {
+		if err := input.SeekTime(cli.Start); err != nil {
+			log.Fatalf("Could not seek to %s: %s", cli.Start, err.Error())
+		}
+	}
+
+	// A negative count means we read to the end of the recording
+	remaining := int64(-1)
+	if cli.End > 0 {
+		remaining = int64((cli.End - cli.Start).Seconds() * sampleRate)
+	}
+	segmentSamples := int64(cli.SegmentDuration.Seconds() * sampleRate)
+
+	outputDir := cli.OutputDir
+	if len(outputDir) == 0 {
+		outputDir = filepath.Dir(cli.File)
+	}
+	base := strings.TrimSuffix(filepath.Base(cli.File), filepath.Ext(cli.File))
+
+	// The read ahead runs in front of us, so keep our own count of where we are in the recording
+	position := input.Position()
+	reader := ziq.StartReadAhead(input, 66560, 8)
+	defer reader.Close()
+
+	var segment *ziq.Writer
+	var segmentPath string
+	var segmentLeft int64
+	index := 0
+	for remaining != 0 {
+		samples, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatalf("Could not read ZIQ file! %s", err.Error())
+		}
+		chunk := samples
+		if remaining > 0 {
+			chunk = chunk[:min(int64(len(chunk)), remaining)]
+			remaining -= int64(len(chunk))
+		}
+
+		for len(chunk) > 0 {
+			if segment == nil {
+				segmentPath = filepath.Join(outputDir, fmt.Sprintf("%s_%03d.ziq", base, index))
+				if segment, err = createSegment(segmentPath, input.Header, index, baseOffset+position); err != nil {
+					log.Fatalf("%s", err.Error())
+				}
+				segmentLeft = segmentSamples
+				index += 1
+			}
+
+			n := int64(len(chunk))
+			if segmentSamples > 0 {
+				n = min(n, segmentLeft)
+			}
+			if err := segment.WriteSamples(chunk[:n]); err != nil {
+				log.Fatalf("Could not write to %s! %s", segmentPath, err.Error())
+			}
+			chunk = chunk[n:]
+			position += n
+			segmentLeft -= n
+
+			if segmentSamples > 0 && segmentLeft == 0 {
+				closeSegment(segment, segmentPath)
+				segment = nil
+			}
+		}
+		reader.Release(samples)
+	}
+	if segment != nil {
+		closeSegment(segment, segmentPath)
+	}
+	log.Infof("Wrote %d segments", index)
+}
+
+// Creates a ziq file for a segment starting offset samples into the original recording
+func createSegment(path string, header ziq.ZiqHeader, index int, offset int64) (*ziq.Writer, error) {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("Output file %s exists! Cowardly not overwriting file...", path)
+	}
+	header.Annotation = ziq.SegmentAnnotation(header.Annotation, index, offset, float64(header.SampleRate))
+	log.Debugf("Starting segment %s at sample %d", path, offset)
+	return ziq.Create(path, header)
+}
+
+func closeSegment(segment *ziq.Writer, path string) {
+	if err := segment.Close(); err != nil {
+		log.Fatalf("Could not finish writing %s! %s", path, err.Error())
+	}
+	log.Infof("Wrote %s", path)
+}
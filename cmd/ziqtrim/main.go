@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools"
+	"github.com/jrwynneiii/ccsds_tools/layers/datalink"
+	"github.com/jrwynneiii/lrittools/config"
+	"github.com/jrwynneiii/lrittools/decoder"
+	"github.com/jrwynneiii/lrittools/ziq"
+)
+
+var cli struct {
+	Verbose     bool          `help:"Prints debug output by default"`
+	File        string        `arg:"" help:"Path to a ziq IQ file"`
+	OutputFile  string        `arg:"" help:"Path to write the trimmed ziq file to"`
+	LockedOnly  bool          `help:"Keep only the parts of the recording where the decoder has frame lock"`
+	Margin      time.Duration `help:"Extra recording to keep before and after each locked span" default:"5s"`
+	MinSpan     time.Duration `help:"Drop locked spans shorter than this" default:"1s"`
+	Preset      string        `help:"Named set of demodulator and decoder settings for the downlink: goes-hrit, goes-lrit, or one from --presets-file" default:"goes-hrit"`
+	PresetsFile string        `help:"JSON file of extra presets; defaults to presets.json in the lrittools user config directory (e.g. ~/.config/lrittools)"`
+}
+
+// How long lock is held after the last good frame. The decoder leaves FrameLock set when it
+// stops finding frames at all, so we also need to see frames coming out of it
+const lockHold = 500 * time.Millisecond
+
+// A span of samples [Start, End) in the input recording
+type span struct {
+	Start int64 `json:"offset_samples"`
+	End   int64 `json:"-"`
+	Count int64 `json:"num_samples"`
+}
+
+func main() {
+	_ = kong.Parse(&cli)
+	if cli.Verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	if !cli.LockedOnly {
+		log.Fatalf("Nothing to do; give --locked-only")
+	}
+	if _, err := os.Stat(cli.OutputFile); !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Output file %s exists! Cowardly not overwriting file...", cli.OutputFile)
+	}
+
+	input, err := ziq.Load(cli.File)
+	if err != nil {
+		log.Fatalf("File %s is not a valid ZIQ file: %s", cli.File, err.Error())
+	}
+	sampleRate := input.SampleRate()
+	if sampleRate == 0 {
+		log.Fatalf("ZIQ header has no sample rate; can not demodulate")
+	}
+
+	spans, total := findLockedSpans(input, sampleRate)
+	input.Close()
+	log.Infof("Found %d locked spans in %d samples", len(spans), total)
+
+	margin := int64(cli.Margin.Seconds() * sampleRate)
+	minSpan := int64(cli.MinSpan.Seconds() * sampleRate)
+	spans = mergeSpans(spans, margin, minSpan, total)
+	if len(spans) == 0 {
+		log.Fatalf("The decoder never locked on to %s; not writing %s", cli.File, cli.OutputFile)
+	}
+
+	if err := writeSpans(cli.File, cli.OutputFile, spans); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+}
+
+// Runs the recording through the demodulator and decoder, returning the spans where the decoder
+// had lock along with the number of samples in the recording
+func findLockedSpans(input *ziq.Ziq, sampleRate float64) ([]span, int64) {
+	options := config.Defaults()
+	options["radio.sample_rate"] = sampleRate
+	if err := applyPreset(options); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if err := config.Derive(options); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	chunkSize := options["xrit.chunk_size"].(int)
+
+	p, feed, err := decoder.NewPipeline(options, ccsds_tools.PhysicalLayer, ccsds_tools.DataLinkLayer)
+	if err != nil {
+		log.Fatalf("Could not start CCSDS pipeline: %s", err.Error())
+	}
+	decode := p.Layers[ccsds_tools.DataLinkLayer].(*datalink.Decoder)
+
+	// Samples handed to the demodulator so far. Whatever is still queued up in front of the
+	// demodulator and decoder has not been looked at yet
+	var sent atomic.Int64
+	samplesPerSymbol := sampleRate / options["xrit.symbol_rate"].(float64)
+	position := func() int64 {
+		queued := feed.Queued() + int64(float64(len(*decode.SymbolsInput))*samplesPerSymbol)
+		return max(sent.Load()-queued, 0)
+	}
+
+	// Closed once everything read has made it into the output of the decoder
+	inputDrained := make(chan struct{})
+
+	// Sample position of the last good frame out of the decoder
+	var lastFrame atomic.Int64
+	lastFrame.Store(-1)
+	// Closed once every frame out of the decoder has been counted
+	drained := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-*decode.FramesOutput:
+				lastFrame.Store(position())
+			case <-inputDrained:
+				for len(*decode.FramesOutput) > 0 {
+					<-*decode.FramesOutput
+					lastFrame.Store(position())
+				}
+				close(drained)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		// The pipeline copies what it needs, so chunks go straight back to the reader
+		reader := ziq.StartReadAhead(input, chunkSize, 8)
+		defer reader.Close()
+		for {
+			chunk, err := reader.Next()
+			if len(chunk) > 0 {
+				feed.Write(chunk)
+				sent.Add(int64(len(chunk)))
+			}
+			reader.Release(chunk)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				log.Errorf("Could not read %s: %s", cli.File, err.Error())
+				break
+			}
+		}
+		feed.Flush()
+		if err := feed.Drain(decoder.DefaultDrainTimeout); err != nil {
+			log.Warnf("%s", err.Error())
+		}
+		close(inputDrained)
+	}()
+
+	p.Start()
+	defer p.Destroy()
+
+	hold := int64(lockHold.Seconds() * sampleRate)
+	var spans []span
+	var current *span
+	poll := func() {
+		pos := position()
+		decode.StatsMutex.RLock()
+		frameLock := decode.FrameLock
+		decode.StatsMutex.RUnlock()
+		last := lastFrame.Load()
+		locked := frameLock && last >= 0 && pos-last < hold
+
+		if locked && current == nil {
+			log.Debugf("Locked at %s", samplesToDuration(pos, sampleRate))
+			current = &span{Start: max(last, 0), End: pos}
+		} else if locked {
+			current.End = pos
+		} else if current != nil {
+			log.Debugf("Lost lock at %s", samplesToDuration(pos, sampleRate))
+			current.End = min(pos, last+hold)
+			spans = append(spans, *current)
+			current = nil
+		}
+	}
+
+	lastLog := time.Now()
+	for finished := false; !finished; {
+		select {
+		case <-drained:
+			finished = true
+		case <-time.After(20 * time.Millisecond):
+		}
+		poll()
+		if time.Since(lastLog) > 5*time.Second {
+			log.Infof("At %s, %d locked spans so far", samplesToDuration(position(), sampleRate), len(spans))
+			lastLog = time.Now()
+		}
+	}
+	if current != nil {
+		spans = append(spans, *current)
+	}
+	return spans, sent.Load()
+}
+
+// Drops spans shorter than minSpan, then widens the rest by margin on each side and merges any
+// that overlap
+func mergeSpans(spans []span, margin, minSpan, total int64) []span {
+	var merged []span
+	for _, s := range spans {
+		if s.End-s.Start < minSpan {
+			continue
+		}
+		s.Start = max(s.Start-margin, 0)
+		s.End = min(s.End+margin, total)
+		if n := len(merged); n > 0 && s.Start <= merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, s.End)
+		} else {
+			merged = append(merged, s)
+		}
+	}
+	for i := range merged {
+		merged[i].Count = merged[i].End - merged[i].Start
+	}
+	return merged
+}
+
+// Copies the given spans of the input recording into a new ziq file
+func writeSpans(inputPath, outputPath string, spans []span) error {
+	input, err := ziq.Load(inputPath)
+	if err != nil {
+		return fmt.Errorf("Could not reopen %s: %w", inputPath, err)
+	}
+	defer input.Close()
+
+	// The start time of the trimmed file is that of the first span; the rest are listed in the
+	// annotation
+	var baseOffset int64
+	if metadata, err := input.Metadata(); err == nil {
+		if offset, ok := metadata.Raw[ziq.SegmentOffsetSamplesKey].(float64); ok {
+			baseOffset = int64(offset)
+		}
+	}
+	// Span offsets in the annotation count from the same place as segment_offset: the start of
+	// the recording the input was itself cut from, if it was
+	annotated := make([]span, len(spans))
+	for i, s := range spans {
+		s.Start += baseOffset
+		annotated[i] = s
+	}
+	header := input.Header
+	header.Annotation = ziq.MergeAnnotation(header.Annotation, map[string]any{
+		ziq.SegmentOffsetSamplesKey: annotated[0].Start,
+		ziq.SegmentOffsetKey:        float64(annotated[0].Start) / input.SampleRate(),
+		"locked_spans":              annotated,
+	})
+	output, err := ziq.Create(outputPath, header)
+	if err != nil {
+		return fmt.Errorf("Could not create %s: %w", outputPath, err)
+	}
+
+	buf := make([]complex64, 66560)
+	var written int64
+	for _, s := range spans {
+		if _, err := input.Seek(s.Start, io.SeekStart); err != nil {
+			output.Close()
+			return fmt.Errorf("Could not seek to sample %d of %s: %w", s.Start, inputPath, err)
+		}
+		for left := s.Count; left > 0; {
+			n, err := input.ReadSamples(buf[:min(int64(len(buf)), left)])
+			if n > 0 {
+				if err := output.WriteSamples(buf[:n]); err != nil {
+					output.Close()
+					return fmt.Errorf("Could not write to %s: %w", outputPath, err)
+				}
+				left -= int64(n)
+				written += int64(n)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				output.Close()
+				return fmt.Errorf("Could not read %s: %w", inputPath, err)
+			}
+		}
+		log.Infof("Kept %s from %s", samplesToDuration(s.Count, input.SampleRate()), samplesToDuration(s.Start, input.SampleRate()))
+	}
+
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("Could not finish writing %s: %w", outputPath, err)
+	}
+	log.Infof("Wrote %s of %s to %s", samplesToDuration(written, input.SampleRate()), inputPath, outputPath)
+	return nil
+}
+
+// Applies --preset, from the built in presets or those in --presets-file
+func applyPreset(options map[string]any) error {
+	presets, err := config.LoadPresets(cli.PresetsFile)
+	if err != nil {
+		return err
+	}
+	return presets.Apply(cli.Preset, options)
+}
+
+func samplesToDuration(samples int64, sampleRate float64) time.Duration {
+	return time.Duration(float64(samples) / sampleRate * float64(time.Second)).Round(time.Millisecond)
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"math"
+)
+
+// The demodulator's clock recovery needs at least two samples per symbol, so we never decimate
+// below that
+const MinSamplesPerSymbol = 2.0
+
+// The demodulator skips any chunk of samples shorter than this, so xrit.chunk_size has to be at
+// least as long
+const MinChunkSize = 64 * 1024
+
+// Default options for the CCSDS pipeline, the input to it and the TUI, keyed the way
+// pipeline.NewWithOptionsMap expects them. A decimation factor, transition width or channel
+// bandwidth of 0 is worked out by Derive, and a carrier.max_offset_hz of 0 searches as far as the
+// sample rate allows. The carrier search is left off here, and turned on by the built in presets
+var defaults = map[string]any{
+	"agc.gain":                      1.0,
+	"agc.max_gain":                  4000.0,
+	"agc.rate":                      0.01,
+	"agc.reference":                 0.5,
+	"carrier.averages":              8,
+	"carrier.fft_size":              65536,
+	"carrier.max_offset_hz":         0.0,
+	"carrier.min_snr_db":            10.0,
+	"carrier.search":                false,
+	"carrier.track_interval_s":      10.0,
+	"cleanup.dc_alpha":              0.0001,
+	"cleanup.dc_block":              false,
+	"cleanup.impulse_alpha":         0.001,
+	"cleanup.impulse_blank":         false,
+	"cleanup.impulse_threshold":     5.0,
+	"cleanup.iq_alpha":              0.0001,
+	"cleanup.iq_balance":            false,
+	"cleanup.report_interval_s":     60.0,
+	"channel.bandwidth_hz":          0.0,
+	"channel.offset_hz":             0.0,
+	"clockrecovery.alpha":           0.0037,
+	"clockrecovery.mu":              0.5,
+	"clockrecovery.omega_limit":     0.005,
+	"radio.sample_rate":             2048000.0,
+	"tui.enable_log_output":         true,
+	"tui.refresh_ms":                500,
+	"tui.rs_threshold_crit_pct":     5.0,
+	"tui.rs_threshold_warn_pct":     2.0,
+	"tui.vit_threshold_crit_pct":    5.0,
+	"tui.vit_threshold_warn_pct":    3.0,
+	"viterbi.max_errors":            500,
+	"xrit.chunk_size":               66560,
+	"xrit.decimation_factor":        0,
+	"xrit.do_fft":                   true,
+	"xrit.lowpass_transition_width": 0.0,
+	"xrit.pll_alpha":                0.001,
+	"xrit.rrc_alpha":                0.3,
+	"xrit.rrc_taps":                 31,
+	"xrit.symbol_rate":              927000.0,
+	"xritframe.frame_size":          1024,
+	"xritframe.last_frame_size":     8,
+}
+
+// Returns a copy of the default options, which the caller is free to change
+func Defaults() map[string]any {
+	return maps.Clone(defaults)
+}
+
+// Works out xrit.decimation_factor, xrit.lowpass_transition_width and channel.bandwidth_hz from
+// radio.sample_rate and xrit.symbol_rate, unless they have been set. The stream is decimated as
+// far as it can be while keeping MinSamplesPerSymbol, and the low-pass filter in front of the
+// decimator passes the channel bandwidth, by default just what the signal occupies, with the
+// transition band as wide as it can be without letting anything alias into it. It also checks
+// that xrit.chunk_size is at least MinChunkSize
+func Derive(options map[string]any) error {
+	if chunkSize := options["xrit.chunk_size"].(int); chunkSize < MinChunkSize {
+		return fmt.Errorf("An xrit.chunk_size of %d is too small; the demodulator skips chunks of fewer than %d samples", chunkSize, MinChunkSize)
+	}
+	sampleRate := options["radio.sample_rate"].(float64)
+	symbolRate := options["xrit.symbol_rate"].(float64)
+	// Two sided bandwidth of the RRC shaped signal
+	occupied := symbolRate * (1 + options["xrit.rrc_alpha"].(float64))
+	if sampleRate < occupied {
+		return fmt.Errorf("A sample rate of %.0f is too low for %.0f symbols/s; it needs to be at least %.0f", sampleRate, symbolRate, occupied)
+	}
+	bandwidth := options["channel.bandwidth_hz"].(float64)
+	if bandwidth <= 0 {
+		bandwidth = occupied
+		options["channel.bandwidth_hz"] = bandwidth
+	}
+	offset := options["channel.offset_hz"].(float64)
+	if math.Abs(offset)+bandwidth/2 > sampleRate/2 {
+		return fmt.Errorf("A %.0f Hz wide channel at %+.0f Hz does not fit in the %.0f Hz captured", bandwidth, offset, sampleRate)
+	}
+
+	decimation := options["xrit.decimation_factor"].(int)
+	if decimation <= 0 {
+		decimation = max(int(sampleRate/(MinSamplesPerSymbol*symbolRate)), 1)
+		options["xrit.decimation_factor"] = decimation
+	}
+	if options["xrit.lowpass_transition_width"].(float64) <= 0 {
+		width := sampleRate/float64(decimation) - bandwidth
+		if width <= 0 {
+			return fmt.Errorf("Decimating by %d leaves too little bandwidth for a %.0f Hz wide channel", decimation, bandwidth)
+		}
+		options["xrit.lowpass_transition_width"] = width
+	}
+	return nil
+}
+
+// Sets an option, converting the value to the type of its default. Numbers may be given as any
+// numeric type, as long as integer options get a whole number
+func Set(options map[string]any, key string, value any) error {
+	def, ok := defaults[key]
+	if !ok {
+		return fmt.Errorf("Unknown option %s", key)
+	}
+
+	var f float64
+	isNumber := true
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	default:
+		isNumber = false
+	}
+
+	switch def.(type) {
+	case float64:
+		if !isNumber {
+			return fmt.Errorf("Option %s must be a number, not %#v", key, value)
+		}
+		options[key] = f
+	case int:
+		if !isNumber || f != math.Trunc(f) {
+			return fmt.Errorf("Option %s must be a whole number, not %#v", key, value)
+		}
+		options[key] = int(f)
+	case bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("Option %s must be true or false, not %#v", key, value)
+		}
+		options[key] = b
+	default:
+		options[key] = value
+	}
+	return nil
+}
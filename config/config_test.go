@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestDeriveChunkSize(t *testing.T) {
+	for _, tc := range []struct {
+		chunkSize int
+		ok        bool
+	}{
+		{MinChunkSize - 1, false},
+		{4096, false},
+		{MinChunkSize, true},
+		{66560, true},
+	} {
+		options := Defaults()
+		if err := Set(options, "xrit.chunk_size", tc.chunkSize); err != nil {
+			t.Fatalf("Set: %s", err)
+		}
+		if err := Derive(options); (err == nil) != tc.ok {
+			t.Errorf("Derive with xrit.chunk_size=%d returned %v", tc.chunkSize, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/hcl"
+	koanfjson "github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/rawbytes"
+	"github.com/knadh/koanf/v2"
+)
+
+// Reads a config file and sets the options in it. The format (HCL, JSON or YAML) comes from the
+// file extension. Options are grouped into sections the same way as their keys, e.g.
+//
+//	xrit {
+//	  symbol_rate = 293883
+//	}
+func LoadFile(options map[string]any, path string) error {
+	var parser koanf.Parser
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hcl", ".conf":
+		parser = hcl.Parser(true)
+	case ".json":
+		parser = koanfjson.Parser()
+	case ".yaml", ".yml":
+		parser = yaml.Parser()
+	default:
+		return fmt.Errorf("Can not tell the format of config file %s; use a .hcl, .json or .yaml extension", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Could not read config file %s: %w", path, err)
+	}
+	k := koanf.New(".")
+	if err := k.Load(rawbytes.Provider(data), parser); err != nil {
+		return fmt.Errorf("Could not parse config file %s: %w", path, err)
+	}
+	for _, key := range k.Keys() {
+		if err := Set(options, key, k.Get(key)); err != nil {
+			return fmt.Errorf("In config file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Sets an option from a key=value string, as given on the command line
+func SetString(options map[string]any, assignment string) error {
+	key, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return fmt.Errorf("Option %q should look like key=value", assignment)
+	}
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	switch defaults[key].(type) {
+	case float64, int:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("Option %s must be a number, not %q", key, value)
+		}
+		return Set(options, key, f)
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Option %s must be true or false, not %q", key, value)
+		}
+		return Set(options, key, b)
+	default:
+		return Set(options, key, value)
+	}
+}
+
+// Writes options out as JSON grouped into sections, which LoadFile can read back in
+func Dump(options map[string]any) ([]byte, error) {
+	sections := map[string]map[string]any{}
+	for key, value := range options {
+		section, name, _ := strings.Cut(key, ".")
+		if sections[section] == nil {
+			sections[section] = map[string]any{}
+		}
+		sections[section][name] = value
+	}
+	return json.MarshalIndent(sections, "", "  ")
+}
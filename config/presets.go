@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A named set of options for a particular downlink
+type Preset map[string]any
+
+type Presets map[string]Preset
+
+const DefaultPreset = "goes-hrit"
+
+var builtinPresets = Presets{
+	// GOES-R series HRIT/EMWIN
+	"goes-hrit": {
+		"xrit.symbol_rate":          927000.0,
+		"xrit.rrc_alpha":            0.3,
+		"xrit.rrc_taps":             31,
+		"xrit.pll_alpha":            0.001,
+		"clockrecovery.alpha":       0.0037,
+		"clockrecovery.mu":          0.5,
+		"clockrecovery.omega_limit": 0.005,
+		"viterbi.max_errors":        500,
+		"carrier.search":            true,
+	},
+	// The older GOES LRIT downlink, at the legacy rate of 293883 symbols/s. Everything else is as
+	// the defaults have it
+	"goes-lrit": {
+		"xrit.symbol_rate": 293883.0,
+		"xrit.rrc_alpha":   0.5,
+		"carrier.search":   true,
+	},
+}
+
+// Returns a copy of the built in presets
+func BuiltinPresets() Presets {
+	presets := Presets{}
+	for name, preset := range builtinPresets {
+		presets[name] = maps.Clone(preset)
+	}
+	return presets
+}
+
+// Returns where user presets are read from by default, e.g. ~/.config/lrittools/presets.json
+func DefaultPresetsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lrittools", "presets.json")
+}
+
+// Returns the built in presets along with the user presets in path. With no path, user presets
+// are read from DefaultPresetsPath if it exists
+func LoadPresets(path string) (Presets, error) {
+	presets := BuiltinPresets()
+	required := len(path) > 0
+	if !required {
+		path = DefaultPresetsPath()
+	}
+	if len(path) > 0 {
+		if err := presets.Load(path, required); err != nil {
+			return nil, err
+		}
+	}
+	return presets, nil
+}
+
+// Reads user presets from a JSON file, mapping each preset name to the options it sets, and adds
+// them to p. Options a user preset leaves out are taken from the preset named by its "base" key,
+// or from DefaultPreset. A file that does not exist is not an error unless required is set
+func (p Presets) Load(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not read presets file %s: %w", path, err)
+	}
+
+	var loaded map[string]map[string]any
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("Could not parse presets file %s: %w", path, err)
+	}
+	// Presets may be based on others in the same file, so build them in order of their bases
+	resolving := map[string]bool{}
+	var resolve func(name string) error
+	resolve = func(name string) error {
+		values, ok := loaded[name]
+		if !ok {
+			return nil
+		}
+		if resolving[name] {
+			return fmt.Errorf("Preset %s in %s ends up based on itself", name, path)
+		}
+		resolving[name] = true
+
+		base := DefaultPreset
+		if b, ok := values["base"].(string); ok {
+			base = b
+		}
+		delete(values, "base")
+		if base != name {
+			if err := resolve(base); err != nil {
+				return err
+			}
+		}
+		preset, ok := p[base]
+		if !ok {
+			return fmt.Errorf("Preset %s in %s is based on unknown preset %s", name, path, base)
+		}
+
+		// Check the values against the defaults, so mistakes show up now rather than when the
+		// preset is used
+		preset = maps.Clone(preset)
+		options := Defaults()
+		for key, value := range values {
+			if err := Set(options, key, value); err != nil {
+				return fmt.Errorf("Preset %s in %s: %w", name, path, err)
+			}
+			preset[key] = options[key]
+		}
+		p[name] = preset
+		delete(loaded, name)
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(loaded)) {
+		if err := resolve(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sets the options from the named preset
+func (p Presets) Apply(name string, options map[string]any) error {
+	preset, ok := p[name]
+	if !ok {
+		return fmt.Errorf("Unknown preset %s; pick one of %s", name, strings.Join(p.Names(), ", "))
+	}
+	for key, value := range preset {
+		if err := Set(options, key, value); err != nil {
+			return fmt.Errorf("Preset %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p Presets) Names() []string {
+	return slices.Sorted(maps.Keys(p))
+}
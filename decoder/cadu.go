@@ -0,0 +1,126 @@
+package decoder
+
+import (
+	"fmt"
+)
+
+const (
+	// Reed-Solomon (255,223) codewords, interleaved this deep in each frame
+	rsInterleave = 4
+	rsData       = 223
+	rsParity     = 32
+	// The datalink layer hands on frames with the sync marker and check symbols taken off
+	VCDUSize = rsInterleave * rsData
+	// Sync marker, frame and Reed-Solomon check symbols, as a CADU is sent
+	CADUSize = 4 + rsInterleave*(rsData+rsParity)
+)
+
+// Attached sync marker that starts every CADU
+var caduSyncMarker = [4]byte{0x1a, 0xcf, 0xfc, 0x1d}
+
+// Tables for the CCSDS Reed-Solomon code: GF(2^8) with field polynomial x^8+x^7+x^2+x+1, and a
+// generator polynomial with roots α^(11*(112+i)) for i in 0..31
+var rs = newReedSolomon()
+
+type reedSolomon struct {
+	alphaTo [256]byte
+	indexOf [256]int
+	// Generator polynomial coefficients, as powers of α
+	genpoly [rsParity + 1]int
+	// Conversions between the conventional basis the code is worked in and the dual basis it is
+	// sent in
+	toDual   [256]byte
+	fromDual [256]byte
+}
+
+func newReedSolomon() *reedSolomon {
+	r := reedSolomon{}
+	const fieldPoly = 0x187
+	const fcr, prim = 112, 11
+	x := 1
+	for i := range 255 {
+		r.alphaTo[i] = byte(x)
+		r.indexOf[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= fieldPoly
+		}
+	}
+	// log(0) has no value; 255 stands in for it
+	r.indexOf[0] = 255
+
+	var genpoly [rsParity + 1]byte
+	genpoly[0] = 1
+	for i, root := 0, fcr*prim; i < rsParity; i, root = i+1, root+prim {
+		genpoly[i+1] = 1
+		for j := i; j > 0; j-- {
+			if genpoly[j] != 0 {
+				genpoly[j] = genpoly[j-1] ^ r.alphaTo[(r.indexOf[genpoly[j]]+root)%255]
+			} else {
+				genpoly[j] = genpoly[j-1]
+			}
+		}
+		genpoly[0] = r.alphaTo[(r.indexOf[genpoly[0]]+root)%255]
+	}
+	for i, g := range genpoly {
+		r.genpoly[i] = r.indexOf[g]
+	}
+
+	// Rows of the CCSDS basis conversion matrix
+	tal := [8]byte{0x8d, 0xef, 0xec, 0x86, 0xfa, 0x99, 0xaf, 0x7b}
+	for i := range 256 {
+		var dual byte
+		for k := range 8 {
+			if i&(1<<k) != 0 {
+				dual ^= tal[7-k]
+			}
+		}
+		r.toDual[i] = dual
+		r.fromDual[dual] = byte(i)
+	}
+	return &r
+}
+
+// Returns the check symbols of one codeword, both in the dual basis
+func (r *reedSolomon) parity(data *[rsData]byte) [rsParity]byte {
+	var parity [rsParity]byte
+	for _, d := range data {
+		feedback := r.indexOf[r.fromDual[d]^parity[0]]
+		copy(parity[:], parity[1:])
+		parity[rsParity-1] = 0
+		if feedback == 255 {
+			continue
+		}
+		for j := range rsParity - 1 {
+			parity[j] ^= r.alphaTo[(feedback+r.genpoly[rsParity-1-j])%255]
+		}
+		parity[rsParity-1] = r.alphaTo[(feedback+r.genpoly[0])%255]
+	}
+	for i, p := range parity {
+		parity[i] = r.toDual[p]
+	}
+	return parity
+}
+
+// Builds the CADU a frame from the datalink layer was sent as, less the randomization: the sync
+// marker, the frame, then its Reed-Solomon check symbols, interleaved as they were sent. The frame
+// has been corrected, so the check symbols are worked out afresh rather than kept
+func EncodeCADU(vcdu []byte) ([]byte, error) {
+	if len(vcdu) != VCDUSize {
+		return nil, fmt.Errorf("Frame is %d bytes, not %d", len(vcdu), VCDUSize)
+	}
+	cadu := make([]byte, CADUSize)
+	copy(cadu, caduSyncMarker[:])
+	copy(cadu[len(caduSyncMarker):], vcdu)
+	checkSymbols := cadu[len(caduSyncMarker)+VCDUSize:]
+	for i := range rsInterleave {
+		var data [rsData]byte
+		for j := range data {
+			data[j] = vcdu[j*rsInterleave+i]
+		}
+		for j, p := range rs.parity(&data) {
+			checkSymbols[j*rsInterleave+i] = p
+		}
+	}
+	return cadu, nil
+}
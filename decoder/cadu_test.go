@@ -0,0 +1,93 @@
+package decoder
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// Multiplies a and b in the field the code is worked in
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return rs.alphaTo[(rs.indexOf[a]+rs.indexOf[b])%255]
+}
+
+// Evaluates the codeword, highest power first, at each root of the generator polynomial. Every
+// syndrome of a valid codeword is zero
+func syndromes(codeword []byte) [rsParity]byte {
+	var s [rsParity]byte
+	for i := range rsParity {
+		root := rs.alphaTo[(11*(112+i))%255]
+		var sum byte
+		for _, c := range codeword {
+			sum = gfMul(sum, root) ^ rs.fromDual[c]
+		}
+		s[i] = sum
+	}
+	return s
+}
+
+func TestReedSolomonTables(t *testing.T) {
+	// α generates every nonzero element of the field
+	seen := make(map[byte]bool)
+	for i := range 255 {
+		seen[rs.alphaTo[i]] = true
+	}
+	if len(seen) != 255 || seen[0] {
+		t.Fatalf("α generates %d elements", len(seen))
+	}
+
+	// The start of the conventional to dual basis table in the CCSDS recommendation, as
+	// libsathelper and libfec have it
+	want := []byte{0x00, 0x7b, 0xaf, 0xd4, 0x99, 0xe2, 0x36, 0x4d, 0xfa, 0x81, 0x55, 0x2e, 0x63, 0x18, 0xcc, 0xb7}
+	if !bytes.Equal(rs.toDual[:len(want)], want) {
+		t.Fatalf("Dual basis table starts % x, want % x", rs.toDual[:len(want)], want)
+	}
+	for i := range 256 {
+		if rs.fromDual[rs.toDual[i]] != byte(i) {
+			t.Fatalf("%#x does not convert back from the dual basis", i)
+		}
+	}
+}
+
+func TestEncodeCADU(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, name := range []string{"zero", "random"} {
+		vcdu := make([]byte, VCDUSize)
+		if name == "random" {
+			rng.Read(vcdu)
+		}
+		cadu, err := EncodeCADU(vcdu)
+		if err != nil {
+			t.Fatalf("%s: EncodeCADU: %s", name, err)
+		}
+		if len(cadu) != CADUSize {
+			t.Fatalf("%s: CADU is %d bytes, want %d", name, len(cadu), CADUSize)
+		}
+		if !bytes.Equal(cadu[:4], caduSyncMarker[:]) || !bytes.Equal(cadu[4:4+VCDUSize], vcdu) {
+			t.Fatalf("%s: CADU does not start with the sync marker and frame", name)
+		}
+
+		// Pull each codeword back out of the interleaving, and check that it is one
+		body := cadu[4:]
+		for i := range rsInterleave {
+			codeword := make([]byte, rsData+rsParity)
+			for j := range codeword {
+				codeword[j] = body[j*rsInterleave+i]
+			}
+			if s := syndromes(codeword); s != [rsParity]byte{} {
+				t.Fatalf("%s: codeword %d has syndromes % x", name, i, s)
+			}
+		}
+	}
+}
+
+func TestEncodeCADUSize(t *testing.T) {
+	for _, size := range []int{0, VCDUSize - 1, VCDUSize + 1, CADUSize} {
+		if _, err := EncodeCADU(make([]byte, size)); err == nil {
+			t.Errorf("EncodeCADU of %d bytes did not fail", size)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/iqdsp"
+)
+
+// How far the carrier has to move before we say so at the info level
+const carrierLogStep = 500.0
+
+// Finds the carrier offset of the input and mixes it back to the center, so the demodulator's
+// PLL only has to pull in whatever is left over. The offset is looked for again every so often
+// to follow drift
+type carrierTracker struct {
+	search     *iqdsp.CarrierSearch
+	mixer      *iqdsp.Mixer
+	sampleRate float64
+	averages   int
+	minSNR     float64
+	// Samples between estimates once the carrier has first been looked for; 0 not to track it
+	trackInterval int64
+	untilTrack    int64
+	acquired      bool
+	// Samples held on to until the carrier has first been looked for
+	pending   []complex64
+	held      atomic.Int64
+	offset    atomic.Uint64
+	found     atomic.Bool
+	lastShown float64
+}
+
+func newCarrierTracker(options map[string]any, sampleRate float64) (*carrierTracker, error) {
+	if fftSize := options["carrier.fft_size"].(int); fftSize < 16 {
+		return nil, fmt.Errorf("Option carrier.fft_size must be at least 16, not %d", fftSize)
+	}
+	c := carrierTracker{
+		search:        iqdsp.NewCarrierSearch(options["carrier.fft_size"].(int), sampleRate, options["carrier.max_offset_hz"].(float64)),
+		mixer:         iqdsp.NewMixer(0, sampleRate),
+		sampleRate:    sampleRate,
+		averages:      max(options["carrier.averages"].(int), 1),
+		minSNR:        options["carrier.min_snr_db"].(float64),
+		trackInterval: int64(options["carrier.track_interval_s"].(float64) * sampleRate),
+	}
+	return &c, nil
+}
+
+// Returns the samples with the carrier offset taken out, mixing them in place. Until the carrier
+// has first been looked for, samples are held on to and nil is returned
+func (c *carrierTracker) Process(samples []complex64) []complex64 {
+	if !c.acquired {
+		c.pending = append(c.pending, samples...)
+		c.held.Store(int64(len(c.pending)))
+		c.search.Add(samples)
+		if c.search.Blocks() < c.averages {
+			return nil
+		}
+		return c.release()
+	}
+
+	samples = c.mixer.Process(samples)
+	if c.trackInterval > 0 {
+		c.track(samples)
+	}
+	return samples
+}
+
+// Returns whatever samples are still held on to, with the carrier looked for in as much as we have
+func (c *carrierTracker) Flush() []complex64 {
+	if c.acquired {
+		return nil
+	}
+	return c.release()
+}
+
+func (c *carrierTracker) release() []complex64 {
+	c.acquired = true
+	estimate, ok := c.search.Estimate()
+	c.search.Reset()
+	c.untilTrack = c.trackInterval
+	if !ok {
+		log.Warnf("Not enough samples to look for the carrier in")
+	} else if estimate.SNRdB < c.minSNR {
+		log.Warnf("Could not find the carrier; the best guess, %+.0f Hz, is only %.1f dB over the noise", estimate.OffsetHz, estimate.SNRdB)
+	} else {
+		log.Infof("Found the carrier %+.0f Hz from the center, %.1f dB over the noise", estimate.OffsetHz, estimate.SNRdB)
+		c.setOffset(estimate.OffsetHz)
+	}
+
+	samples := c.mixer.Process(c.pending)
+	c.pending = nil
+	c.held.Store(0)
+	return samples
+}
+
+// Looks for the carrier in the first few FFTs' worth of samples once every trackInterval
+func (c *carrierTracker) track(samples []complex64) {
+	if c.untilTrack > 0 {
+		n := min(int64(len(samples)), c.untilTrack)
+		c.untilTrack -= n
+		samples = samples[n:]
+	}
+	if len(samples) == 0 {
+		return
+	}
+	c.search.Add(samples)
+	if c.search.Blocks() < c.averages {
+		return
+	}
+
+	estimate, _ := c.search.Estimate()
+	c.search.Reset()
+	c.untilTrack = c.trackInterval
+	if estimate.SNRdB < c.minSNR {
+		log.Debugf("Lost sight of the carrier; the best guess is only %.1f dB over the noise", estimate.SNRdB)
+		return
+	}
+	// The samples have already been corrected, so what is left is how far the carrier has moved
+	offset, found := c.Offset()
+	offset += estimate.OffsetHz
+	c.setOffset(offset)
+	if !found {
+		log.Infof("Found the carrier %+.0f Hz from the center, %.1f dB over the noise", offset, estimate.SNRdB)
+	} else if math.Abs(offset-c.lastShown) >= carrierLogStep {
+		log.Infof("Carrier has drifted to %+.0f Hz from the center", offset)
+	} else {
+		log.Debugf("Carrier is %+.0f Hz from the center, %.1f dB over the noise", offset, estimate.SNRdB)
+		return
+	}
+	c.lastShown = offset
+}
+
+func (c *carrierTracker) setOffset(offset float64) {
+	c.mixer.SetShift(-offset, c.sampleRate)
+	c.offset.Store(math.Float64bits(offset))
+	if !c.found.Swap(true) {
+		c.lastShown = offset
+	}
+}
+
+// Returns the carrier offset being corrected for, and whether the carrier has been found at all.
+// This may be called from any goroutine
+func (c *carrierTracker) Offset() (float64, bool) {
+	return math.Float64frombits(c.offset.Load()), c.found.Load()
+}
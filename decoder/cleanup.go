@@ -0,0 +1,80 @@
+package decoder
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/lrittools/iqdsp"
+)
+
+// Cleans up the input of cheap receivers before anything else looks at it: takes out the DC
+// offset, blanks impulse noise and balances I and Q, as set by the cleanup options. What the
+// signal looked like before and after is logged every cleanup.report_interval_s
+type cleanup struct {
+	stages  []iqdsp.Stage
+	blanker *iqdsp.ImpulseBlanker
+	before  *iqdsp.Stats
+	after   *iqdsp.Stats
+	// Blanked count at the start of the current report
+	blanked        int64
+	sampleRate     float64
+	reportInterval int64
+}
+
+// Returns the cleanup stages the options ask for, or nil if there are none
+func newCleanup(options map[string]any, sampleRate float64) *cleanup {
+	c := cleanup{
+		before:         iqdsp.NewStats(1),
+		after:          iqdsp.NewStats(1),
+		sampleRate:     sampleRate,
+		reportInterval: int64(options["cleanup.report_interval_s"].(float64) * sampleRate),
+	}
+	// The IQ balancer and blanker both go by the power of the signal, which any DC offset throws
+	// off, so it goes first
+	if options["cleanup.dc_block"].(bool) {
+		c.stages = append(c.stages, iqdsp.NewDCBlocker(options["cleanup.dc_alpha"].(float64)))
+	}
+	if options["cleanup.impulse_blank"].(bool) {
+		c.blanker = iqdsp.NewImpulseBlanker(options["cleanup.impulse_threshold"].(float64), options["cleanup.impulse_alpha"].(float64))
+		c.stages = append(c.stages, c.blanker)
+	}
+	if options["cleanup.iq_balance"].(bool) {
+		c.stages = append(c.stages, iqdsp.NewIQBalancer(options["cleanup.iq_alpha"].(float64)))
+	}
+	if len(c.stages) == 0 {
+		return nil
+	}
+	return &c
+}
+
+// Cleans up samples in place, returning them
+func (c *cleanup) Process(samples []complex64) []complex64 {
+	c.before.Add(samples)
+	for _, stage := range c.stages {
+		samples = stage.Process(samples)
+	}
+	c.after.Add(samples)
+	if c.reportInterval > 0 && c.before.Count >= c.reportInterval {
+		c.report()
+	}
+	return samples
+}
+
+// Logs what the cleanup has done since the last report, and starts a new one
+func (c *cleanup) report() {
+	if c.before.Count == 0 {
+		return
+	}
+	before, after := c.before.Summary(), c.after.Summary()
+	duration := time.Duration(float64(before.Samples) / c.sampleRate * float64(time.Second)).Round(time.Millisecond)
+	log.Infof("Input cleanup over %s: DC offset %+.4f%+.4fj -> %+.4f%+.4fj, I/Q imbalance %+.2f dB %+.2f° -> %+.2f dB %+.2f°, RMS %.2f dBFS -> %.2f dBFS",
+		duration, before.DCOffsetI, before.DCOffsetQ, after.DCOffsetI, after.DCOffsetQ,
+		before.IQImbalanceDB, before.IQPhaseDeg, after.IQImbalanceDB, after.IQPhaseDeg, before.RMSdBFS, after.RMSdBFS)
+	if c.blanker != nil {
+		blanked := c.blanker.Blanked - c.blanked
+		log.Infof("Blanked %d samples (%.3f%%) of impulse noise", blanked, 100*float64(blanked)/float64(before.Samples))
+		c.blanked = c.blanker.Blanked
+	}
+	c.before = iqdsp.NewStats(1)
+	c.after = iqdsp.NewStats(1)
+}
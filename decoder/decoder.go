@@ -0,0 +1,163 @@
+package decoder
+
+import (
+	"maps"
+	"sync/atomic"
+
+	"github.com/jrwynneiii/ccsds_tools"
+	"github.com/jrwynneiii/ccsds_tools/pipeline"
+	"github.com/jrwynneiii/lrittools/iqdsp"
+)
+
+// Feeds samples into the physical layer of a CCSDS pipeline. ccsds_tools can decimate the stream
+// itself, but its AGC and RRC filter do not take the decimation into account, so we do it here
+// and run the pipeline at the decimated rate. A channel off the center of a wideband input is
+// mixed down ahead of the decimator, whose low-pass filter then pulls it out of the rest
+type Input struct {
+	samplesIn  *chan []complex64
+	links      *links
+	cleanup    *cleanup
+	channel    *iqdsp.Mixer
+	carrier    *carrierTracker
+	decimator  *iqdsp.Resampler
+	decimation int
+	chunkSize  int
+	chunk      []complex64
+	// Length of chunk, for Queued
+	partial atomic.Int64
+}
+
+// Builds a pipeline from options and registers the given layers with it, which must include the
+// physical layer. xrit.decimation_factor and xrit.lowpass_transition_width are applied by the
+// returned Input rather than the pipeline, as are channel.offset_hz, the cleanup stages and the
+// carrier search
+func NewPipeline(options map[string]any, layers ...ccsds_tools.LayerType) (*pipeline.Pipeline, *Input, error) {
+	sampleRate := options["radio.sample_rate"].(float64)
+	decimation := max(options["xrit.decimation_factor"].(int), 1)
+	in := Input{
+		decimation: decimation,
+		chunkSize:  options["xrit.chunk_size"].(int),
+	}
+
+	in.cleanup = newCleanup(options, sampleRate)
+	if offset := options["channel.offset_hz"].(float64); offset != 0 {
+		in.channel = iqdsp.NewMixer(-offset, sampleRate)
+	}
+	if options["carrier.search"].(bool) {
+		var err error
+		if in.carrier, err = newCarrierTracker(options, sampleRate); err != nil {
+			return nil, nil, err
+		}
+	}
+	if decimation > 1 {
+		var err error
+		cutoff := 0.5 / float64(decimation)
+		transition := options["xrit.lowpass_transition_width"].(float64) / sampleRate
+		if in.decimator, err = iqdsp.NewLowPassDecimator(decimation, cutoff, transition); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pipelineOptions := maps.Clone(options)
+	pipelineOptions["radio.sample_rate"] = sampleRate / float64(decimation)
+	pipelineOptions["xrit.decimation_factor"] = 1
+
+	p := pipeline.NewWithOptionsMap(pipelineOptions)
+	for _, layer := range layers {
+		p.Register(layer)
+	}
+	in.samplesIn = p.Layers[ccsds_tools.PhysicalLayer].GetInput().(*chan []complex64)
+	in.links = newLinks(p)
+	return p, &in, nil
+}
+
+// Hands samples to the pipeline, blocking while its input is full. The samples may be modified
+// in place, but are copied into chunks of xrit.chunk_size before they are passed on
+func (in *Input) Write(samples []complex64) {
+	if in.cleanup != nil {
+		samples = in.cleanup.Process(samples)
+	}
+	if in.channel != nil {
+		samples = in.channel.Process(samples)
+	}
+	if in.carrier != nil {
+		if samples = in.carrier.Process(samples); len(samples) == 0 {
+			return
+		}
+	}
+	in.write(samples)
+}
+
+func (in *Input) write(samples []complex64) {
+	out := samples
+	if in.decimator != nil {
+		out = in.decimator.Process(samples)
+	}
+
+	// The demodulator skips short chunks, so build up whole chunks at the pipeline's rate
+	for len(out) > 0 {
+		if in.chunk == nil {
+			in.chunk = make([]complex64, 0, in.chunkSize)
+		}
+		n := min(len(out), in.chunkSize-len(in.chunk))
+		in.chunk = append(in.chunk, out[:n]...)
+		out = out[n:]
+		if len(in.chunk) == in.chunkSize {
+			in.sendChunk()
+		}
+	}
+	in.partial.Store(int64(len(in.chunk)))
+}
+
+func (in *Input) sendChunk() {
+	*in.samplesIn <- in.chunk
+	in.chunk = nil
+	in.partial.Store(0)
+}
+
+// Hands any held back samples to the pipeline at the end of the input. The demodulator skips
+// chunks short of xrit.chunk_size, so the last one is filled out with silence
+func (in *Input) Flush() {
+	if in.cleanup != nil {
+		in.cleanup.report()
+	}
+	if in.carrier != nil {
+		if samples := in.carrier.Flush(); len(samples) > 0 {
+			in.write(samples)
+		}
+	}
+	if n := len(in.chunk); n > 0 {
+		in.chunk = in.chunk[:in.chunkSize]
+		clear(in.chunk[n:])
+		in.sendChunk()
+	}
+}
+
+// Returns how much the stream is decimated before it reaches the pipeline
+func (in *Input) Decimation() int {
+	return in.decimation
+}
+
+// Returns roughly how many input samples are waiting in front of the demodulator. Unlike Write,
+// this may be called from any goroutine
+func (in *Input) Queued() int64 {
+	queued := (int64(len(*in.samplesIn)*in.chunkSize) + in.partial.Load()) * int64(in.decimation)
+	if in.carrier != nil {
+		queued += in.carrier.held.Load()
+	}
+	return queued
+}
+
+// Returns whether the carrier is being searched for, as set by carrier.search
+func (in *Input) SearchingForCarrier() bool {
+	return in.carrier != nil
+}
+
+// Returns the carrier offset in Hz being taken out of the input, and whether the carrier has been
+// found. This may be called from any goroutine
+func (in *Input) CarrierOffset() (float64, bool) {
+	if in.carrier == nil {
+		return 0, false
+	}
+	return in.carrier.Offset()
+}
@@ -0,0 +1,150 @@
+package decoder
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jrwynneiii/ccsds_tools"
+	"github.com/jrwynneiii/lrittools/config"
+	"github.com/jrwynneiii/lrittools/iqdsp"
+)
+
+const testChunkSize = 64 * 1024
+
+// Returns an Input that hands its chunks to a channel of our own rather than a pipeline
+func testInput(t *testing.T, decimation int) (*Input, chan []complex64) {
+	t.Helper()
+	samplesIn := make(chan []complex64, 16)
+	in := &Input{samplesIn: &samplesIn, decimation: decimation, chunkSize: testChunkSize}
+	if decimation > 1 {
+		var err error
+		if in.decimator, err = iqdsp.NewLowPassDecimator(decimation, 0.5/float64(decimation), 0.05); err != nil {
+			t.Fatalf("NewLowPassDecimator: %s", err)
+		}
+	}
+	return in, samplesIn
+}
+
+func TestInputChunks(t *testing.T) {
+	for _, decimation := range []int{1, 2} {
+		in, samplesIn := testInput(t, decimation)
+		// Write in pieces that do not line up with the chunks
+		samples := make([]complex64, 5*testChunkSize/2*decimation)
+		for i := range samples {
+			samples[i] = complex(float32(i%7)/7, 0)
+		}
+		for start := 0; start < len(samples); start += 10000 {
+			in.Write(samples[start:min(start+10000, len(samples))])
+		}
+		if len(samplesIn) != 2 {
+			t.Fatalf("Decimated by %d: %d chunks sent before the end, want 2", decimation, len(samplesIn))
+		}
+		if queued := in.Queued(); queued != int64(5*testChunkSize/2*decimation) {
+			t.Errorf("Decimated by %d: %d samples queued, want %d", decimation, queued, 5*testChunkSize/2*decimation)
+		}
+
+		in.Flush()
+		if len(samplesIn) != 3 {
+			t.Fatalf("Decimated by %d: %d chunks sent, want 3", decimation, len(samplesIn))
+		}
+		for range 3 {
+			// The demodulator skips anything shorter
+			if chunk := <-samplesIn; len(chunk) != testChunkSize {
+				t.Fatalf("Decimated by %d: sent a chunk of %d samples, want %d", decimation, len(chunk), testChunkSize)
+			}
+		}
+	}
+}
+
+func TestInputFlushKeepsTheEnd(t *testing.T) {
+	in, samplesIn := testInput(t, 1)
+	samples := make([]complex64, testChunkSize+1000)
+	for i := range samples {
+		samples[i] = complex(1, float32(i))
+	}
+	in.Write(samples)
+	in.Flush()
+	if len(samplesIn) != 2 {
+		t.Fatalf("%d chunks sent, want 2", len(samplesIn))
+	}
+	<-samplesIn
+	last := <-samplesIn
+	if len(last) != testChunkSize {
+		t.Fatalf("Last chunk is %d samples, want %d", len(last), testChunkSize)
+	}
+	for i, v := range last {
+		want := complex64(0)
+		if i < 1000 {
+			want = samples[testChunkSize+i]
+		}
+		if v != want {
+			t.Fatalf("Sample %d of the last chunk is %v, want %v", i, v, want)
+		}
+	}
+
+	// Nothing more is sent for an input that ends on a whole chunk
+	in.Flush()
+	if len(samplesIn) != 0 {
+		t.Fatalf("Flushing again sent %d more chunks", len(samplesIn))
+	}
+}
+
+func TestDrain(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		layers []ccsds_tools.LayerType
+	}{
+		{"decoder", []ccsds_tools.LayerType{ccsds_tools.PhysicalLayer, ccsds_tools.DataLinkLayer}},
+		{"session", []ccsds_tools.LayerType{ccsds_tools.PhysicalLayer, ccsds_tools.DataLinkLayer, ccsds_tools.TransportLayer, ccsds_tools.SessionLayer}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			options := config.Defaults()
+			options["radio.sample_rate"] = 2048000.0
+			if err := config.Derive(options); err != nil {
+				t.Fatalf("Derive: %s", err)
+			}
+			p, in, err := NewPipeline(options, tc.layers...)
+			if err != nil {
+				t.Fatalf("NewPipeline: %s", err)
+			}
+			symbols, err := TapSymbols(in, filepath.Join(t.TempDir(), "symbols.bin"))
+			if err != nil {
+				t.Fatalf("TapSymbols: %s", err)
+			}
+			defer symbols.Close()
+			if _, err := TapFrames(in, filepath.Join(t.TempDir(), "frames.cadu")); (err == nil) != (in.links.transport != nil) {
+				t.Fatalf("TapFrames returned %v", err)
+			}
+			p.Start()
+
+			// Noise, a little over three chunks' worth after decimation
+			rng := rand.New(rand.NewSource(1))
+			samples := make([]complex64, 10000)
+			for range (3*options["xrit.chunk_size"].(int) + 5000) * in.Decimation() / len(samples) {
+				for i := range samples {
+					samples[i] = complex(float32(rng.NormFloat64()), float32(rng.NormFloat64()))
+				}
+				in.Write(samples)
+			}
+			in.Flush()
+			if err := in.Drain(10 * time.Second); err != nil {
+				t.Fatalf("Drain: %s", err)
+			}
+
+			if n := len(*in.samplesIn); n != 0 {
+				t.Errorf("%d chunks left in front of the demodulator", n)
+			}
+			// Every symbol out of the demodulator went to the decoder, and at least two frames of
+			// filler after it have been taken
+			if count, sent := symbols.Count(), in.links.lastSent.Load(); count == 0 || count != sent {
+				t.Errorf("%d symbols written to the tap and %d handed to the decoder", count, sent)
+			}
+			frameSize := int64(in.links.decoder.EncodedFrameSize)
+			if taken := in.links.sent.Load() - int64(len(in.links.symbols)); taken < in.links.lastSent.Load()+2*frameSize-1 {
+				t.Errorf("The decoder has taken %d symbols, and %d were real", taken, in.links.lastSent.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package decoder
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jrwynneiii/ccsds_tools"
+	"github.com/jrwynneiii/ccsds_tools/layers/datalink"
+	"github.com/jrwynneiii/ccsds_tools/layers/physical"
+	"github.com/jrwynneiii/ccsds_tools/layers/session"
+	"github.com/jrwynneiii/ccsds_tools/layers/transport"
+	"github.com/jrwynneiii/ccsds_tools/packets"
+	"github.com/jrwynneiii/ccsds_tools/pipeline"
+)
+
+// How long Drain waits for anything at all to move through the pipeline before giving up on it.
+// Only a layer that has stopped working should ever get near this
+const DefaultDrainTimeout = 30 * time.Second
+
+const drainPoll = 10 * time.Millisecond
+
+// Stands between the layers of a pipeline, passing on what comes out of each and counting it, so
+// Drain can tell when everything handed to the pipeline has come out the other end. None of the
+// layers say when they are partway through something, so each hand-off is set up so that the
+// layer taking something has finished with whatever it took before:
+//   - The demodulator takes one chunk at a time, so once it has taken an empty chunk sent after
+//     the last one, every symbol is out of it
+//   - The decoder takes a frame of symbols at a time, plus up to a frame more to line up with the
+//     sync word. Once it has taken two frames beyond the last symbol, it has started on a frame
+//     after the one that symbol went into
+//   - The transport layer is handed frames one at a time, so once it has taken a fill frame, which
+//     it ignores, every frame before is through it
+//   - The session layer is driven from here, a transport file at a time
+type links struct {
+	moved atomic.Int64
+
+	decoder   *datalink.Decoder
+	symbols   chan byte
+	sent      atomic.Int64
+	lastSent  atomic.Int64
+	transport *transport.TransportLayer
+	frames    chan []byte
+	session   *session.LRITGen
+
+	flushSymbols chan chan struct{}
+	flushFrames  chan chan struct{}
+	flushFiles   chan chan struct{}
+
+	lock       sync.Mutex
+	symbolTaps []*Tap
+	frameTaps  []*Tap
+}
+
+// Puts links between the registered layers of p, which must not have been started yet
+func newLinks(p *pipeline.Pipeline) *links {
+	l := links{
+		flushSymbols: make(chan chan struct{}),
+		flushFrames:  make(chan chan struct{}),
+		flushFiles:   make(chan chan struct{}),
+	}
+	demod := p.Layers[ccsds_tools.PhysicalLayer].(*physical.Demodulator)
+	if decoder, ok := p.Layers[ccsds_tools.DataLinkLayer].(*datalink.Decoder); ok {
+		l.decoder = decoder
+		l.symbols = make(chan byte, cap(*decoder.SymbolsInput))
+		decoder.SymbolsInput = &l.symbols
+		go l.passSymbols(*demod.SymbolsOutput)
+	}
+	if layer, ok := p.Layers[ccsds_tools.TransportLayer].(*transport.TransportLayer); ok {
+		l.transport = layer
+		// Unbuffered, so a frame is only taken once the one before has been dealt with
+		l.frames = make(chan []byte)
+		from := *layer.FramesInput
+		layer.FramesInput = &l.frames
+		go l.passFrames(from)
+	}
+	if layer, ok := p.Layers[ccsds_tools.SessionLayer].(*session.LRITGen); ok {
+		l.session = layer
+		// The session layer is left waiting on a channel nothing is sent to
+		from := *layer.TransportInput
+		idle := make(chan *packets.TransportFile)
+		layer.TransportInput = &idle
+		go l.passFiles(from)
+	}
+	return &l
+}
+
+func (l *links) addTap(taps *[]*Tap, t *Tap) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	*taps = append(*taps, t)
+}
+
+func (l *links) taps(taps *[]*Tap) []*Tap {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return *taps
+}
+
+func (l *links) passSymbols(from chan byte) {
+	buf := make([]byte, 0, 4096)
+	pass := func(symbol byte) {
+		buf = append(buf, symbol)
+		// Write out whenever we catch up, so nothing is left behind once the input stops
+		if len(buf) == cap(buf) || len(from) == 0 {
+			for _, t := range l.taps(&l.symbolTaps) {
+				t.write(buf, int64(len(buf)))
+			}
+			buf = buf[:0]
+		}
+		l.symbols <- symbol
+		l.sent.Add(1)
+		l.moved.Add(1)
+	}
+	for {
+		select {
+		case symbol := <-from:
+			pass(symbol)
+		case done := <-l.flushSymbols:
+			for len(from) > 0 {
+				pass(<-from)
+			}
+			l.lastSent.Store(l.sent.Load())
+			close(done)
+			// A soft symbol of 0 says nothing about the bit it stands in for
+			for range 3 * l.decoder.EncodedFrameSize {
+				l.symbols <- 0
+				l.sent.Add(1)
+				l.moved.Add(1)
+			}
+		}
+	}
+}
+
+func (l *links) passFrames(from chan []byte) {
+	pass := func(frame []byte) {
+		for _, t := range l.taps(&l.frameTaps) {
+			if cadu, err := EncodeCADU(frame); err != nil {
+				log.Warnf("Not writing a CADU to %s: %s", t.path, err.Error())
+			} else {
+				t.write(cadu, 1)
+			}
+		}
+		l.frames <- frame
+		l.moved.Add(1)
+	}
+	drained := false
+	for {
+		select {
+		case frame := <-from:
+			// Anything after the drain was decoded from the symbols put in to flush the decoder
+			if !drained {
+				pass(frame)
+			}
+		case done := <-l.flushFrames:
+			for len(from) > 0 {
+				pass(<-from)
+			}
+			// Virtual channel 63 holds fill, which the transport layer ignores
+			fill := make([]byte, VCDUSize)
+			fill[1] = 0x3f
+			l.frames <- fill
+			drained = true
+			close(done)
+		}
+	}
+}
+
+func (l *links) passFiles(from chan *packets.TransportFile) {
+	for {
+		select {
+		case file := <-from:
+			l.session.ProcessTransportFile(file)
+			l.moved.Add(1)
+		case done := <-l.flushFiles:
+			for len(from) > 0 {
+				l.session.ProcessTransportFile(<-from)
+				l.moved.Add(1)
+			}
+			close(done)
+		}
+	}
+}
+
+// Waits for everything written so far to work its way through the pipeline, one layer at a time,
+// and returns an error if timeout passes without anything moving. Whatever comes out of the last
+// layer is for the caller to read, and has to be read while this runs. Flush should be called
+// first, and nothing may be written once this has been called
+func (in *Input) Drain(timeout time.Duration) error {
+	l := in.links
+	progress := func() [2]int64 {
+		return [2]int64{l.moved.Load(), int64(len(*in.samplesIn))}
+	}
+	// Waits for done to return true, giving up once nothing has moved for timeout
+	wait := func(layer string, done func() bool) error {
+		last, since := progress(), time.Now()
+		for !done() {
+			time.Sleep(drainPoll)
+			if now := progress(); now != last {
+				last, since = now, time.Now()
+			} else if time.Since(since) > timeout {
+				return fmt.Errorf("Gave up draining the %s layer after %s without progress", layer, timeout)
+			}
+		}
+		return nil
+	}
+	// Asks one of the links to pass on what it has left, and waits for it to
+	flush := func(layer string, requests chan chan struct{}) error {
+		done := make(chan struct{})
+		if err := wait(layer, func() bool {
+			select {
+			case requests <- done:
+				return true
+			default:
+				return false
+			}
+		}); err != nil {
+			return err
+		}
+		return wait(layer, func() bool {
+			select {
+			case <-done:
+				return true
+			default:
+				return false
+			}
+		})
+	}
+
+	// The demodulator skips short chunks, an empty one included
+	if err := wait("physical", func() bool {
+		select {
+		case *in.samplesIn <- nil:
+			return true
+		default:
+			return false
+		}
+	}); err != nil {
+		return err
+	}
+	if err := wait("physical", func() bool { return len(*in.samplesIn) == 0 }); err != nil {
+		return err
+	}
+	log.Debugf("The physical layer is drained")
+
+	if l.decoder != nil {
+		if err := flush("datalink", l.flushSymbols); err != nil {
+			return err
+		}
+		// The decoder takes at most two frames of symbols for any one frame it puts out, so past
+		// this it is working on filler
+		want := l.lastSent.Load() + 2*int64(l.decoder.EncodedFrameSize) - 1
+		if err := wait("datalink", func() bool {
+			sent := l.sent.Load()
+			return sent-int64(len(l.symbols)) >= want
+		}); err != nil {
+			return err
+		}
+		log.Debugf("The datalink layer is drained")
+	}
+	if l.transport != nil {
+		if err := flush("transport", l.flushFrames); err != nil {
+			return err
+		}
+		log.Debugf("The transport layer is drained")
+	}
+	if l.session != nil {
+		if err := flush("session", l.flushFiles); err != nil {
+			return err
+		}
+		log.Debugf("The session layer is drained")
+	}
+	return nil
+}
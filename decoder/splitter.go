@@ -0,0 +1,51 @@
+package decoder
+
+import (
+	"slices"
+)
+
+// Feeds one wideband input to the Inputs of several pipelines, each pulling its own channel out
+// of it. The cleanup stages are run once, on the wideband samples, before they are split
+type Splitter struct {
+	cleanup *cleanup
+	inputs  []*Input
+}
+
+// Returns a Splitter feeding the given Inputs, which takes over their cleanup stages. The Inputs
+// must have been built from the same options, other than channel.offset_hz
+func NewSplitter(inputs ...*Input) *Splitter {
+	s := Splitter{inputs: inputs}
+	if len(inputs) > 0 {
+		s.cleanup = inputs[0].cleanup
+	}
+	for _, in := range inputs {
+		in.cleanup = nil
+	}
+	return &s
+}
+
+// Hands samples to every Input, blocking while any of their pipelines is full. As with
+// Input.Write, the samples may be modified in place
+func (s *Splitter) Write(samples []complex64) {
+	if s.cleanup != nil {
+		samples = s.cleanup.Process(samples)
+	}
+	for i, in := range s.inputs {
+		// Inputs work on the samples in place, so all but the last get a copy of their own
+		if i < len(s.inputs)-1 {
+			in.Write(slices.Clone(samples))
+		} else {
+			in.Write(samples)
+		}
+	}
+}
+
+// Flushes every Input at the end of the input
+func (s *Splitter) Flush() {
+	if s.cleanup != nil {
+		s.cleanup.report()
+	}
+	for _, in := range s.inputs {
+		in.Flush()
+	}
+}
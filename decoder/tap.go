@@ -0,0 +1,101 @@
+package decoder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Copies what passes between two layers of a pipeline into a file, as the links between them
+// pass it on (see Input.Drain). Whatever has come out of the first layer has been written out by
+// the time the second can see it
+type Tap struct {
+	path   string
+	lock   sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	err    error
+	closed bool
+	count  int64
+}
+
+func newTap(path string) (*Tap, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create %s: %w", path, err)
+	}
+	return &Tap{path: path, file: file, w: bufio.NewWriterSize(file, 1<<20)}, nil
+}
+
+// Writes the soft symbols coming out of the demodulator to path, one signed byte per symbol, as
+// other decoders read them. Must be called before the pipeline is started
+func TapSymbols(in *Input, path string) (*Tap, error) {
+	if in.links.decoder == nil {
+		return nil, fmt.Errorf("No datalink layer to tap the symbols going into")
+	}
+	t, err := newTap(path)
+	if err != nil {
+		return nil, err
+	}
+	in.links.addTap(&in.links.symbolTaps, t)
+	return t, nil
+}
+
+// Writes the frames coming out of the datalink layer to path as CADUs (see EncodeCADU), the
+// format other decoders read frames in. Only frames that passed Reed-Solomon decoding come out
+// of the datalink layer. Must be called before the pipeline is started
+func TapFrames(in *Input, path string) (*Tap, error) {
+	if in.links.transport == nil {
+		return nil, fmt.Errorf("No transport layer to tap the frames going into")
+	}
+	t, err := newTap(path)
+	if err != nil {
+		return nil, err
+	}
+	in.links.addTap(&in.links.frameTaps, t)
+	return t, nil
+}
+
+func (t *Tap) write(data []byte, n int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed || t.err != nil {
+		return
+	}
+	if _, err := t.w.Write(data); err != nil {
+		t.err = fmt.Errorf("Could not write %s: %w", t.path, err)
+		return
+	}
+	t.count += n
+}
+
+// Returns the path being written to
+func (t *Tap) Path() string {
+	return t.path
+}
+
+// Returns how many symbols or frames have been written so far
+func (t *Tap) Count() int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.count
+}
+
+// Flushes and closes the file, returning the first error writing it. Anything that comes through
+// afterwards is passed on, but not written
+func (t *Tap) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return t.err
+	}
+	t.closed = true
+	if err := t.w.Flush(); err != nil && t.err == nil {
+		t.err = fmt.Errorf("Could not write %s: %w", t.path, err)
+	}
+	if err := t.file.Close(); err != nil && t.err == nil {
+		t.err = fmt.Errorf("Could not write %s: %w", t.path, err)
+	}
+	return t.err
+}
@@ -8,7 +8,13 @@ require (
 	github.com/charmbracelet/log v0.4.2
 	github.com/gdamore/tcell/v2 v2.9.0
 	github.com/jrwynneiii/ccsds_tools v0.0.0-20251127174629-25e48dd2a95e
+	github.com/knadh/koanf/parsers/hcl v1.0.0
+	github.com/knadh/koanf/parsers/json v1.0.1
+	github.com/knadh/koanf/parsers/yaml v1.1.1
+	github.com/knadh/koanf/providers/rawbytes v1.0.0
+	github.com/knadh/koanf/v2 v2.3.0
 	github.com/rivo/tview v0.42.0
+	gonum.org/v1/gonum v0.16.0
 )
 
 require (
@@ -22,8 +28,8 @@ require (
 	github.com/gdamore/encoding v1.0.1 // indirect
 	github.com/go-logfmt/logfmt v0.6.1 // indirect
 	github.com/go-viper/mapstructure/v2 v2.4.0 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/knadh/koanf/maps v0.1.2 // indirect
-	github.com/knadh/koanf/v2 v2.3.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.3.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.19 // indirect
@@ -35,9 +41,9 @@ require (
 	github.com/racerxdl/segdsp v0.0.0-20190825170906-a855d00a24a8 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
+	go.yaml.in/yaml/v3 v3.0.3 // indirect
 	golang.org/x/exp v0.0.0-20251009144603-d2f985daa21b // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/term v0.36.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
-	gonum.org/v1/gonum v0.16.0 // indirect
 )
@@ -0,0 +1,120 @@
+package iqdsp
+
+import (
+	"math"
+	"slices"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// Finds the carrier of a BPSK signal. Squaring the signal strips off the modulation, leaving a
+// tone at twice the carrier offset, which shows up as the peak of an averaged FFT
+type CarrierSearch struct {
+	sampleRate float64
+	maxOffset  float64
+	fft        *fourier.CmplxFFT
+	window     []float64
+	block      []complex128
+	coeffs     []complex128
+	power      []float64
+	blocks     int
+}
+
+// What CarrierSearch made of the signal
+type CarrierEstimate struct {
+	// Offset of the carrier from the center of the band
+	OffsetHz float64
+	// How far the tone stands above the median of the squared spectrum
+	SNRdB float64
+}
+
+// Returns a CarrierSearch with FFTs of fftSize samples, looking for carriers up to maxOffset from
+// the center. Squaring doubles the offset, so it can not find anything past a quarter of the
+// sample rate
+func NewCarrierSearch(fftSize int, sampleRate, maxOffset float64) *CarrierSearch {
+	window := make([]float64, fftSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(fftSize))
+	}
+	if maxOffset <= 0 || maxOffset > sampleRate/4 {
+		maxOffset = sampleRate / 4
+	}
+	return &CarrierSearch{
+		sampleRate: sampleRate,
+		maxOffset:  maxOffset,
+		fft:        fourier.NewCmplxFFT(fftSize),
+		window:     window,
+		block:      make([]complex128, 0, fftSize),
+		coeffs:     make([]complex128, fftSize),
+		power:      make([]float64, fftSize),
+	}
+}
+
+// Adds samples to the averaged spectrum. Samples short of a whole FFT are kept for the next call
+func (c *CarrierSearch) Add(samples []complex64) {
+	for len(samples) > 0 {
+		n := min(len(samples), cap(c.block)-len(c.block))
+		for _, s := range samples[:n] {
+			v := complex128(s)
+			c.block = append(c.block, v*v)
+		}
+		samples = samples[n:]
+		if len(c.block) < cap(c.block) {
+			break
+		}
+
+		for i, w := range c.window {
+			c.block[i] *= complex(w, 0)
+		}
+		c.fft.Coefficients(c.coeffs, c.block)
+		for i, v := range c.coeffs {
+			c.power[i] += real(v)*real(v) + imag(v)*imag(v)
+		}
+		c.block = c.block[:0]
+		c.blocks += 1
+	}
+}
+
+// Returns the number of FFTs averaged so far
+func (c *CarrierSearch) Blocks() int {
+	return c.blocks
+}
+
+// Returns the strongest carrier in the averaged spectrum, or false if nothing has been added yet
+func (c *CarrierSearch) Estimate() (CarrierEstimate, bool) {
+	if c.blocks == 0 {
+		return CarrierEstimate{}, false
+	}
+	n := len(c.power)
+	limit := 2 * c.maxOffset / c.sampleRate
+	peak := -1
+	for i, p := range c.power {
+		if math.Abs(c.fft.Freq(i)) <= limit && (peak < 0 || p > c.power[peak]) {
+			peak = i
+		}
+	}
+
+	// Fit a parabola through the peak and its neighbours to get between the bins
+	left, center, right := c.power[(peak+n-1)%n], c.power[peak], c.power[(peak+1)%n]
+	delta := 0.0
+	if denom := left - 2*center + right; denom != 0 {
+		delta = 0.5 * (left - right) / denom
+	}
+	tone := (c.fft.Freq(peak) + delta/float64(n)) * c.sampleRate
+
+	sorted := slices.Clone(c.power)
+	slices.Sort(sorted)
+	median := sorted[n/2]
+	snr := math.Inf(1)
+	if median > 0 {
+		snr = 10 * math.Log10(center/median)
+	}
+	return CarrierEstimate{OffsetHz: tone / 2, SNRdB: snr}, true
+}
+
+// Starts a new average
+func (c *CarrierSearch) Reset() {
+	clear(c.power)
+	c.block = c.block[:0]
+	c.blocks = 0
+}
@@ -0,0 +1,155 @@
+package iqdsp
+
+import (
+	"math"
+)
+
+// Takes the DC offset out of a stream, following it with a running average as it wanders
+type DCBlocker struct {
+	alpha   float64
+	started bool
+	meanI   float64
+	meanQ   float64
+}
+
+// Returns a DCBlocker whose running average moves alpha of the way to each new sample. The
+// notch it leaves at DC is about alpha*sampleRate/2π wide
+func NewDCBlocker(alpha float64) *DCBlocker {
+	return &DCBlocker{alpha: alpha}
+}
+
+// Takes the DC offset out of samples in place, returning them
+func (d *DCBlocker) Process(samples []complex64) []complex64 {
+	if !d.started && len(samples) > 0 {
+		// Start from the mean of the first block, rather than taking ages to settle from 0
+		for _, v := range samples {
+			d.meanI += float64(real(v))
+			d.meanQ += float64(imag(v))
+		}
+		d.meanI /= float64(len(samples))
+		d.meanQ /= float64(len(samples))
+		d.started = true
+	}
+	for n, v := range samples {
+		i, q := float64(real(v)), float64(imag(v))
+		d.meanI += d.alpha * (i - d.meanI)
+		d.meanQ += d.alpha * (q - d.meanQ)
+		samples[n] = complex(float32(i-d.meanI), float32(q-d.meanQ))
+	}
+	return samples
+}
+
+// Corrects the gain and phase imbalance between I and Q by adaptively taking out the part of Q
+// that correlates with I, then scaling what is left to the power of I. This assumes the signal
+// has no DC offset
+type IQBalancer struct {
+	alpha   float64
+	started bool
+	powerI  float64
+	powerQ  float64
+	corr    float64
+}
+
+func NewIQBalancer(alpha float64) *IQBalancer {
+	return &IQBalancer{alpha: alpha}
+}
+
+// Balances samples in place, returning them
+func (b *IQBalancer) Process(samples []complex64) []complex64 {
+	if !b.started && len(samples) > 0 {
+		for _, v := range samples {
+			i, q := float64(real(v)), float64(imag(v))
+			b.powerI += i * i
+			b.corr += i * q
+		}
+		b.powerI /= float64(len(samples))
+		b.corr /= float64(len(samples))
+		for _, v := range samples {
+			i, q := float64(real(v)), float64(imag(v))
+			if b.powerI > 0 {
+				q -= b.corr / b.powerI * i
+			}
+			b.powerQ += q * q
+		}
+		b.powerQ /= float64(len(samples))
+		b.started = true
+	}
+	for n, v := range samples {
+		i, q := float64(real(v)), float64(imag(v))
+		b.powerI += b.alpha * (i*i - b.powerI)
+		b.corr += b.alpha * (i*q - b.corr)
+		if b.powerI <= 0 {
+			continue
+		}
+		q -= b.corr / b.powerI * i
+		b.powerQ += b.alpha * (q*q - b.powerQ)
+		if b.powerQ > 0 {
+			q *= math.Sqrt(b.powerI / b.powerQ)
+		}
+		samples[n] = complex(float32(i), float32(q))
+	}
+	return samples
+}
+
+// Samples blanked after each impulse, which rings on through the receiver's filters
+const impulseHold = 4
+
+// Longest run of samples blanked in a row. Anything longer is taken to be the signal level going
+// up rather than impulse noise, and the running average starts over from it
+const maxImpulseRun = 1024
+
+// How much slower the running average moves over blanked samples than over the rest, so that it
+// still follows the level without being pulled up much by the impulses themselves
+const impulseSlowdown = 16
+
+// Zeroes samples whose magnitude jumps well above the running RMS, as impulse noise does
+type ImpulseBlanker struct {
+	// Power over the running average that counts as an impulse
+	threshold float64
+	alpha     float64
+	started   bool
+	power     float64
+	hold      int
+	run       int
+	// Number of samples blanked so far
+	Blanked int64
+}
+
+// Returns an ImpulseBlanker that blanks samples with a magnitude over threshold times the running
+// RMS magnitude, which moves alpha of the way to each sample that is not blanked, and a fraction of
+// that to each sample that is
+func NewImpulseBlanker(threshold, alpha float64) *ImpulseBlanker {
+	return &ImpulseBlanker{threshold: threshold * threshold, alpha: alpha}
+}
+
+// Blanks impulses in samples in place, returning them
+func (b *ImpulseBlanker) Process(samples []complex64) []complex64 {
+	if !b.started && len(samples) > 0 {
+		for _, v := range samples {
+			b.power += float64(real(v))*float64(real(v)) + float64(imag(v))*float64(imag(v))
+		}
+		b.power /= float64(len(samples))
+		b.started = true
+	}
+	for n, v := range samples {
+		p := float64(real(v))*float64(real(v)) + float64(imag(v))*float64(imag(v))
+		if b.power > 0 && p > b.threshold*b.power {
+			b.hold = impulseHold + 1
+		}
+		if b.hold > 0 && b.run >= maxImpulseRun {
+			b.power = p
+			b.hold = 0
+		}
+		if b.hold > 0 {
+			samples[n] = 0
+			b.hold -= 1
+			b.run += 1
+			b.Blanked += 1
+			b.power += b.alpha / impulseSlowdown * (p - b.power)
+			continue
+		}
+		b.run = 0
+		b.power += b.alpha * (p - b.power)
+	}
+	return samples
+}
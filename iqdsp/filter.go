@@ -0,0 +1,35 @@
+package iqdsp
+
+import (
+	"math"
+)
+
+// Designs a windowed sinc low-pass filter with unity gain at DC. cutoff is the -6 dB point and
+// transition the width of the transition band, both as a fraction of the sample rate. Uses a
+// Blackman window, which gives roughly 74 dB of stopband attenuation
+func LowPassTaps(cutoff, transition float64) []float32 {
+	n := int(math.Ceil(5.5 / transition))
+	if n%2 == 0 {
+		n++
+	}
+
+	taps := make([]float64, n)
+	var sum float64
+	mid := float64(n-1) / 2
+	for i := range taps {
+		x := float64(i) - mid
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		window := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(n-1))
+		taps[i] = sinc * window
+		sum += taps[i]
+	}
+
+	out := make([]float32, n)
+	for i, t := range taps {
+		out[i] = float32(t / sum)
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package iqdsp
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Shifts a stream of samples in frequency with a numerically controlled oscillator
+type Mixer struct {
+	phase complex128
+	step  complex128
+}
+
+// Returns a Mixer that moves the spectrum up by shiftHz; a signal at +shiftHz from the center
+// is brought to the center with a negative shift
+func NewMixer(shiftHz, sampleRate float64) *Mixer {
+	return &Mixer{
+		phase: 1,
+		step:  rotation(shiftHz, sampleRate),
+	}
+}
+
+// Changes the shift, carrying on from the current phase of the oscillator
+func (m *Mixer) SetShift(shiftHz, sampleRate float64) {
+	m.step = rotation(shiftHz, sampleRate)
+}
+
+// Mixes samples in place, returning them
+func (m *Mixer) Process(samples []complex64) []complex64 {
+	phase := m.phase
+	for i, s := range samples {
+		samples[i] = s * complex64(phase)
+		phase *= m.step
+	}
+	// Keep rounding errors from growing the oscillator's amplitude over long recordings
+	m.phase = phase / complex(cmplx.Abs(phase), 0)
+	return samples
+}
+
+// Returns the phase rotation of one sample at the given frequency
+func rotation(shiftHz, sampleRate float64) complex128 {
+	return cmplx.Rect(1, 2*math.Pi*shiftHz/sampleRate)
+}
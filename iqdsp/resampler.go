@@ -0,0 +1,129 @@
+package iqdsp
+
+import (
+	"fmt"
+)
+
+// A step in a chain of sample processing. The returned samples may be the input modified in
+// place, or a buffer that is reused by the next call
+type Stage interface {
+	Process(in []complex64) []complex64
+}
+
+// Largest interpolation factor we will build a filter bank for
+const MaxInterpolation = 1024
+
+// Resamples a stream by a rational factor of interp/decim with a polyphase low-pass FIR, which
+// also keeps whatever is above the new Nyquist rate from aliasing in. With interp set to 1 this
+// is a plain decimator
+type Resampler struct {
+	interp int64
+	decim  int64
+	// phases[p][k] is tap p + k*interp of the prototype filter
+	phases  [][]float32
+	history []complex64
+	buf     []complex64
+	out     []complex64
+	// Position of the next output sample in the upsampled stream, relative to the first new input
+	t int64
+}
+
+func NewResampler(interp, decim int) (*Resampler, error) {
+	if interp < 1 || decim < 1 {
+		return nil, fmt.Errorf("Invalid resampling ratio %d/%d", interp, decim)
+	}
+	if interp > MaxInterpolation {
+		return nil, fmt.Errorf("Resampling ratio %d/%d needs too large a filter bank; pick a rate closer to a simple fraction of the input rate", interp, decim)
+	}
+
+	// Keep the passband under the lower of the two Nyquist rates, at the upsampled rate
+	band := 1.0 / float64(max(interp, decim))
+	return newResampler(interp, decim, LowPassTaps(0.45*band, 0.1*band)), nil
+}
+
+// Returns a Resampler that decimates by the given factor
+func NewDecimator(decim int) (*Resampler, error) {
+	return NewResampler(1, decim)
+}
+
+// Returns a Resampler that decimates by the given factor, with a low-pass filter of the given
+// cutoff and transition width as fractions of the input rate. A narrow signal can get away with a
+// much wider transition band than NewDecimator uses, which makes for a far shorter filter
+func NewLowPassDecimator(decim int, cutoff, transition float64) (*Resampler, error) {
+	if decim < 1 {
+		return nil, fmt.Errorf("Invalid decimation factor %d", decim)
+	}
+	if cutoff <= 0 || transition <= 0 || cutoff+transition/2 > 0.5 {
+		return nil, fmt.Errorf("Invalid low-pass filter: cutoff %f, transition %f", cutoff, transition)
+	}
+	return newResampler(1, decim, LowPassTaps(cutoff, transition)), nil
+}
+
+func newResampler(interp, decim int, taps []float32) *Resampler {
+	perPhase := (len(taps) + interp - 1) / interp
+	phases := make([][]float32, interp)
+	for p := range phases {
+		phases[p] = make([]float32, perPhase)
+		for k := range phases[p] {
+			if i := p + k*interp; i < len(taps) {
+				// Zero stuffing drops the gain by interp, so make it back up here
+				phases[p][k] = taps[i] * float32(interp)
+			}
+		}
+	}
+
+	return &Resampler{
+		interp:  int64(interp),
+		decim:   int64(decim),
+		phases:  phases,
+		history: make([]complex64, perPhase-1),
+	}
+}
+
+// Returns a Resampler from inRate to outRate, with the ratio reduced to its lowest terms
+func NewRateResampler(inRate, outRate int64) (*Resampler, error) {
+	if inRate <= 0 || outRate <= 0 {
+		return nil, fmt.Errorf("Invalid resampling rates %d -> %d", inRate, outRate)
+	}
+	g := gcd(inRate, outRate)
+	return NewResampler(int(outRate/g), int(inRate/g))
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Resamples in, returning the output samples. The returned slice is reused by the next call
+func (r *Resampler) Process(in []complex64) []complex64 {
+	r.buf = append(append(r.buf[:0], r.history...), in...)
+	taps := int64(len(r.history)) + 1
+	r.out = r.out[:0]
+
+	for {
+		i := r.t/r.interp + taps - 1
+		if i >= int64(len(r.buf)) {
+			break
+		}
+		phase := r.phases[r.t%r.interp]
+		var accI, accQ float32
+		for k, h := range phase {
+			s := r.buf[i-int64(k)]
+			accI += real(s) * h
+			accQ += imag(s) * h
+		}
+		r.out = append(r.out, complex(accI, accQ))
+		r.t += r.decim
+	}
+
+	r.t -= int64(len(in)) * r.interp
+	copy(r.history, r.buf[len(r.buf)-len(r.history):])
+	return r.out
+}
+
+// Returns the output rate for the given input rate
+func (r *Resampler) OutputRate(inRate float64) float64 {
+	return inRate * float64(r.interp) / float64(r.decim)
+}
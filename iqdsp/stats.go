@@ -0,0 +1,150 @@
+package iqdsp
+
+import (
+	"math"
+)
+
+// Normalized integer samples sit on the rails at +/-1.0, so any component at or beyond this is
+// treated as clipped
+const ClipLevel = 1.0
+
+// Accumulates signal statistics over a stream of normalized IQ samples
+type Stats struct {
+	Count     int64
+	sumI      float64
+	sumQ      float64
+	sumI2     float64
+	sumQ2     float64
+	sumIQ     float64
+	clipped   int64
+	histogram []int64
+	// Magnitude covered by the histogram; larger magnitudes land in the last bin
+	histMax float64
+}
+
+type HistogramBin struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int64   `json:"count"`
+}
+
+// Summary of a Stats, with powers in dB relative to full scale
+type Summary struct {
+	Samples        int64          `json:"samples"`
+	DCOffsetI      float64        `json:"dc_offset_i"`
+	DCOffsetQ      float64        `json:"dc_offset_q"`
+	IQImbalanceDB  float64        `json:"iq_imbalance_db"`
+	IQPhaseDeg     float64        `json:"iq_phase_deg"`
+	RMS            float64        `json:"rms"`
+	RMSdBFS        float64        `json:"rms_dbfs"`
+	ClippedPercent float64        `json:"clipped_percent"`
+	Histogram      []HistogramBin `json:"histogram"`
+}
+
+// Returns a Stats with a magnitude histogram of the given number of bins, spanning 0 to the
+// magnitude of a full scale sample on both I and Q
+func NewStats(bins int) *Stats {
+	return &Stats{
+		histogram: make([]int64, max(bins, 1)),
+		histMax:   math.Sqrt2,
+	}
+}
+
+func (s *Stats) Add(samples []complex64) {
+	bins := float64(len(s.histogram))
+	for _, v := range samples {
+		i, q := float64(real(v)), float64(imag(v))
+		s.sumI += i
+		s.sumQ += q
+		s.sumI2 += i * i
+		s.sumQ2 += q * q
+		s.sumIQ += i * q
+		if math.Abs(i) >= ClipLevel || math.Abs(q) >= ClipLevel {
+			s.clipped++
+		}
+
+		bin := int(math.Sqrt(i*i+q*q) / s.histMax * bins)
+		s.histogram[min(bin, len(s.histogram)-1)]++
+	}
+	s.Count += int64(len(samples))
+}
+
+// Returns the mean of the I and Q components
+func (s *Stats) DCOffset() (float64, float64) {
+	if s.Count == 0 {
+		return 0, 0
+	}
+	return s.sumI / float64(s.Count), s.sumQ / float64(s.Count)
+}
+
+// Returns the ratio of I to Q amplitude in dB, once the DC offset is taken out
+func (s *Stats) IQImbalanceDB() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	dcI, dcQ := s.DCOffset()
+	varI := s.sumI2/float64(s.Count) - dcI*dcI
+	varQ := s.sumQ2/float64(s.Count) - dcQ*dcQ
+	if varI <= 0 || varQ <= 0 {
+		return 0
+	}
+	return 10 * math.Log10(varI/varQ)
+}
+
+// Returns how far I and Q are from being in quadrature, in degrees, once the DC offset is taken
+// out
+func (s *Stats) IQPhaseDeg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	dcI, dcQ := s.DCOffset()
+	varI := s.sumI2/float64(s.Count) - dcI*dcI
+	varQ := s.sumQ2/float64(s.Count) - dcQ*dcQ
+	if varI <= 0 || varQ <= 0 {
+		return 0
+	}
+	corr := (s.sumIQ/float64(s.Count) - dcI*dcQ) / math.Sqrt(varI*varQ)
+	return math.Asin(max(min(corr, 1), -1)) * 180 / math.Pi
+}
+
+// Returns the RMS magnitude of the samples
+func (s *Stats) RMS() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return math.Sqrt((s.sumI2 + s.sumQ2) / float64(s.Count))
+}
+
+func (s *Stats) ClippedPercent() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return 100 * float64(s.clipped) / float64(s.Count)
+}
+
+func (s *Stats) Histogram() []HistogramBin {
+	width := s.histMax / float64(len(s.histogram))
+	bins := make([]HistogramBin, len(s.histogram))
+	for i, count := range s.histogram {
+		bins[i] = HistogramBin{Low: float64(i) * width, High: float64(i+1) * width, Count: count}
+	}
+	return bins
+}
+
+func (s *Stats) Summary() Summary {
+	dcI, dcQ := s.DCOffset()
+	rms := s.RMS()
+	// Floored so that silence still marshals to JSON
+	rmsdBFS := 20 * math.Log10(max(rms, 1e-10))
+	return Summary{
+		Samples:        s.Count,
+		DCOffsetI:      dcI,
+		DCOffsetQ:      dcQ,
+		IQImbalanceDB:  s.IQImbalanceDB(),
+		IQPhaseDeg:     s.IQPhaseDeg(),
+		RMS:            rms,
+		RMSdBFS:        rmsdBFS,
+		ClippedPercent: s.ClippedPercent(),
+		Histogram:      s.Histogram(),
+	}
+}
@@ -0,0 +1,120 @@
+package playback
+
+import (
+	"sync"
+	"time"
+)
+
+// How far behind schedule we let playback fall before giving up on catching up
+const maxLag = 1 * time.Second
+
+// Paces a stream of samples to a sample rate, so a recording plays back as fast as it was made,
+// or at some multiple of that. Playback can be paused and resumed from any goroutine
+type Pacer struct {
+	sampleRate float64
+	speed      float64
+	start      time.Time
+	samples    int64
+	lock       sync.Mutex
+	// Closed by Resume; nil while playing
+	resumed chan struct{}
+}
+
+func NewPacer(sampleRate float64) *Pacer {
+	return &Pacer{sampleRate: sampleRate, speed: 1}
+}
+
+// Blocks until n more samples are due, or for as long as playback is paused. If the consumer has
+// fallen too far behind, the schedule is restarted from now rather than bursting to catch up
+func (p *Pacer) Wait(n int) {
+	p.lock.Lock()
+	for p.resumed != nil {
+		resumed := p.resumed
+		p.lock.Unlock()
+		<-resumed
+		p.lock.Lock()
+		// Carry on from now, rather than rushing to make up for the time spent paused
+		p.start = time.Time{}
+	}
+	if p.speed == 0 {
+		p.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if p.start.IsZero() || now.Sub(p.due()) > maxLag {
+		p.start = now
+		p.samples = 0
+	}
+	p.samples += int64(n)
+	wait := time.Until(p.due())
+	p.lock.Unlock()
+	time.Sleep(wait)
+}
+
+// Returns when the samples waited for so far are due
+func (p *Pacer) due() time.Time {
+	return p.start.Add(time.Duration(float64(p.samples) / (p.sampleRate * p.speed) * float64(time.Second)))
+}
+
+// Restarts the schedule from the next call to Wait
+func (p *Pacer) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.start = time.Time{}
+	p.samples = 0
+}
+
+// Sets how many times faster than real time to play back. A speed of 0 does not pace playback at
+// all, though it can still be paused
+func (p *Pacer) SetSpeed(speed float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.speed = speed
+	p.start = time.Time{}
+	p.samples = 0
+}
+
+func (p *Pacer) Speed() float64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.speed
+}
+
+// Stops Wait from returning until Resume is called
+func (p *Pacer) Pause() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+}
+
+func (p *Pacer) Resume() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+}
+
+func (p *Pacer) Paused() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.resumed != nil
+}
+
+// Pauses playback if it is playing and resumes it if it is paused, returning whether it is now
+// paused
+func (p *Pacer) TogglePause() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+		return false
+	}
+	p.resumed = make(chan struct{})
+	return true
+}
@@ -2,18 +2,18 @@ package tui
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/gdamore/tcell/v2"
-	"github.com/jrwynneiii/ccsds_tools"
 	"github.com/jrwynneiii/ccsds_tools/layers/datalink"
 	"github.com/jrwynneiii/ccsds_tools/layers/physical"
-	"github.com/jrwynneiii/ccsds_tools/layers/session"
 	"github.com/jrwynneiii/ccsds_tools/lrit"
-	"github.com/jrwynneiii/ccsds_tools/pipeline"
+	"github.com/jrwynneiii/lrittools/decoder"
+	"github.com/jrwynneiii/lrittools/playback"
 	"github.com/rivo/tview"
 )
 
@@ -94,7 +94,7 @@ func WriteOverallDecoderStats(d DecoderStats) {
 }
 
 func (l *LockTableData) GetRowCount() int {
-	return 6
+	return 8
 }
 
 func (l *LockTableData) GetColumnCount() int {
@@ -167,14 +167,51 @@ func (l *LockTableData) GetCell(row, column int) *tview.TableCell {
 		}
 
 		return tview.NewTableCell(fmt.Sprintf("%s%f", color, snr))
+	case 6:
+		if column == 0 {
+			return tview.NewTableCell("Playback:")
+		}
+
+		switch {
+		case playbackPacer == nil:
+			return tview.NewTableCell("live")
+		case playbackPacer.Paused():
+			return tview.NewTableCell("[yellow]paused (p to resume)")
+		case playbackPacer.Speed() == 0:
+			return tview.NewTableCell("as fast as possible")
+		default:
+			return tview.NewTableCell(fmt.Sprintf("%gx real time", playbackPacer.Speed()))
+		}
+	case 7:
+		if column == 0 {
+			return tview.NewTableCell("Carrier offset:")
+		}
+
+		if inputFeed == nil || !inputFeed.SearchingForCarrier() {
+			return tview.NewTableCell("not searched for")
+		}
+		offset, found := inputFeed.CarrierOffset()
+		if !found {
+			return tview.NewTableCell("[red]not found")
+		}
+		return tview.NewTableCell(fmt.Sprintf("%+.0f Hz", offset))
 	default:
 		return tview.NewTableCell("ERROR")
 	}
-	return tview.NewTableCell("ERROR")
 }
 
-func StartZiq2LRITUI(pipeline *pipeline.Pipeline, decoder *datalink.Decoder, demodulator *physical.Demodulator, outputDir string, tuiConf TuiConf) {
+// Paces playback of the recording being decoded; nil for live input
+var playbackPacer *playback.Pacer
+
+// Feeds the pipeline, and knows where it found the carrier
+var inputFeed *decoder.Input
+
+// Runs the ziq2lrit TUI until the user quits or stop is closed, listing each file read from files.
+// p pauses and resumes pacer, if there is one
+func StartZiq2LRITUI(feed *decoder.Input, datalinkDecoder *datalink.Decoder, demodulator *physical.Demodulator, pacer *playback.Pacer, files <-chan *lrit.File, stop <-chan struct{}, tuiConf TuiConf) {
 	app := tview.NewApplication()
+	playbackPacer = pacer
+	inputFeed = feed
 
 	LogOut = tview.NewTextView().
 		SetDynamicColors(true).
@@ -249,7 +286,6 @@ func StartZiq2LRITUI(pipeline *pipeline.Pipeline, decoder *datalink.Decoder, dem
 	page.AddItem(leftCol, 0, 2, false)
 	page.AddItem(rightCol, 0, 5, false)
 
-	sessionOut := pipeline.Layers[ccsds_tools.SessionLayer].(*session.LRITGen).GetOutput().(*chan *lrit.File)
 	//descHasFocus := false
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -415,6 +451,14 @@ Data: `
 		switch event.Rune() {
 		case 'q':
 			app.Stop()
+		case 'p':
+			if pacer != nil {
+				if pacer.TogglePause() {
+					log.Infof("Paused playback")
+				} else {
+					log.Infof("Resumed playback")
+				}
+			}
 		}
 		return event
 	})
@@ -422,11 +466,11 @@ Data: `
 	go func() {
 		for {
 			// Gather stats from decoder
-			decoder.StatsMutex.RLock()
-			frameLock := decoder.FrameLock
-			totalFrames := decoder.TotalFramesProcessed
+			datalinkDecoder.StatsMutex.RLock()
+			frameLock := datalinkDecoder.FrameLock
+			totalFrames := datalinkDecoder.TotalFramesProcessed
 
-			decoder.StatsMutex.RUnlock()
+			datalinkDecoder.StatsMutex.RUnlock()
 
 			//Update signal plot data and SNR
 			demodulator.FFTMutex.RLock()
@@ -460,20 +504,21 @@ Data: `
 	}()
 
 	go func() {
-		for {
-			select {
-			case f := <-*sessionOut:
-				LRITTableList.Files = append(LRITTableList.Files, f)
-				log.Infof("Got file %s from session layer", f.GetName())
-				if len(outputDir) > 0 {
-					f.WriteFile(outputDir)
-				}
-			}
+		for f := range files {
+			LRITTableList.Files = append(LRITTableList.Files, f)
+			log.Infof("Got file %s from session layer", f.GetName())
 		}
 	}()
 
+	go func() {
+		<-stop
+		app.Stop()
+	}()
+
 	// Start the TUI
 	if err := app.SetRoot(page, true).EnableMouse(false).SetFocus(lritTable).Run(); err != nil {
 		log.Fatalf("Could not start UI: %v", err)
 	}
+	// Anything logged from here on would go to a screen that is gone
+	log.SetOutput(os.Stderr)
 }
@@ -0,0 +1,128 @@
+package ziq
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/DataDog/zstd"
+)
+
+// Compresses a body as a series of independent zstd frames, several at a time, and writes them
+// out in order. The result is the same framing the Writer produces on its own
+type frameCompressor struct {
+	out       io.Writer
+	frameSize int
+	workers   int
+	frame     []byte
+	jobs      chan *frameJob
+	pending   []*frameJob
+	free      [][]byte
+	submitted int
+	wg        sync.WaitGroup
+	closed    bool
+}
+
+type frameJob struct {
+	data       []byte
+	compressed []byte
+	err        error
+	done       chan struct{}
+}
+
+func newFrameCompressor(out io.Writer, level, workers, frameSize int) *frameCompressor {
+	c := &frameCompressor{
+		out:       out,
+		frameSize: frameSize,
+		workers:   workers,
+		jobs:      make(chan *frameJob, workers),
+	}
+	c.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer c.wg.Done()
+			for job := range c.jobs {
+				job.compressed, job.err = zstd.CompressLevel(nil, job.data, level)
+				close(job.done)
+			}
+		}()
+	}
+	return c
+}
+
+func (c *frameCompressor) write(data []byte) error {
+	for len(data) > 0 {
+		if c.frame == nil {
+			c.frame = c.buffer()
+		}
+		n := min(len(data), c.frameSize-len(c.frame))
+		c.frame = append(c.frame, data[:n]...)
+		data = data[n:]
+		if len(c.frame) == c.frameSize {
+			if err := c.submit(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *frameCompressor) buffer() []byte {
+	if n := len(c.free); n > 0 {
+		buf := c.free[n-1]
+		c.free = c.free[:n-1]
+		return buf
+	}
+	return make([]byte, 0, c.frameSize)
+}
+
+// Hands the current frame to the workers, writing out finished frames once enough are queued up
+func (c *frameCompressor) submit() error {
+	job := &frameJob{data: c.frame, done: make(chan struct{})}
+	c.frame = nil
+	c.jobs <- job
+	c.pending = append(c.pending, job)
+	c.submitted += 1
+	if len(c.pending) > 2*c.workers {
+		return c.writeOldest()
+	}
+	return nil
+}
+
+func (c *frameCompressor) writeOldest() error {
+	job := c.pending[0]
+	c.pending = c.pending[1:]
+	<-job.done
+	c.free = append(c.free, job.data[:0])
+	if job.err != nil {
+		return fmt.Errorf("Could not compress ziq frame: %w", job.err)
+	}
+	if _, err := c.out.Write(job.compressed); err != nil {
+		return fmt.Errorf("Could not write ziq data: %w", err)
+	}
+	return nil
+}
+
+// Compresses whatever is left and writes out all outstanding frames
+func (c *frameCompressor) close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	var err error
+	if len(c.frame) > 0 || c.submitted == 0 {
+		if c.frame == nil {
+			c.frame = c.buffer()
+		}
+		err = c.submit()
+	}
+	close(c.jobs)
+	for len(c.pending) > 0 {
+		if e := c.writeOldest(); err == nil {
+			err = e
+		}
+	}
+	c.wg.Wait()
+	return err
+}
@@ -0,0 +1,170 @@
+package ziq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var ErrUnsupportedFormat error = fmt.Errorf("Unsupported IQ sample format")
+
+type SampleFormat string
+
+const (
+	CS8  SampleFormat = "cs8"
+	CS16 SampleFormat = "cs16"
+	CF32 SampleFormat = "cf32"
+	// 64 bit floats. This can not be stored in a ziq file either
+	CF64 SampleFormat = "cf64"
+	// 8 bit unsigned offset binary, as produced by rtl_sdr. This can not be stored in a ziq file
+	CU8 SampleFormat = "cu8"
+)
+
+// Returns the sample format stored with the given bits per sample
+func FormatForDepth(bps uint8) SampleFormat {
+	switch bps {
+	case 8:
+		return CS8
+	case 16:
+		return CS16
+	case 32:
+		return CF32
+	default:
+		return SampleFormat(fmt.Sprintf("unknown (%d bit)", bps))
+	}
+}
+
+// Parses a sample format name such as cs16
+func ParseSampleFormat(name string) (SampleFormat, error) {
+	format := SampleFormat(strings.ToLower(name))
+	if format.componentSize() == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+	}
+	return format, nil
+}
+
+// Returns the size in bytes of a single I or Q component, or 0 for unknown formats
+func (f SampleFormat) componentSize() int {
+	switch f {
+	case CS8, CU8:
+		return 1
+	case CS16:
+		return 2
+	case CF32:
+		return 4
+	case CF64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Returns the size in bytes of a whole IQ sample
+func (f SampleFormat) SampleSize() int {
+	return 2 * f.componentSize()
+}
+
+// Converts interleaved IQ components from input into output, returning the number of samples written
+func bytesToComplexSlice(format SampleFormat, input []byte, output []complex64, normalize bool) (int, error) {
+	width := format.componentSize()
+	if width == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	n := min(len(input)/(2*width), len(output))
+
+	switch format {
+	case CS8:
+		// 8 bit signed ints
+		divisor := float32(1.0)
+		if normalize {
+			divisor = float32(127.0)
+		}
+		for i := 0; i < n; i++ {
+			r := float32(int8(input[2*i])) / divisor
+			q := float32(int8(input[2*i+1])) / divisor
+			output[i] = complex(r, q)
+		}
+	case CU8:
+		// 8 bit unsigned ints centered on 127.5
+		divisor := float32(1.0)
+		if normalize {
+			divisor = float32(127.5)
+		}
+		for i := 0; i < n; i++ {
+			r := (float32(input[2*i]) - 127.5) / divisor
+			q := (float32(input[2*i+1]) - 127.5) / divisor
+			output[i] = complex(r, q)
+		}
+	case CS16:
+		// 16 bit little endian signed ints
+		divisor := float32(1.0)
+		if normalize {
+			divisor = float32(32767.0)
+		}
+		for i := 0; i < n; i++ {
+			r := float32(int16(binary.LittleEndian.Uint16(input[4*i:]))) / divisor
+			q := float32(int16(binary.LittleEndian.Uint16(input[4*i+2:]))) / divisor
+			output[i] = complex(r, q)
+		}
+	case CF32:
+		// 32 bit little endian floats; these are already normalized
+		for i := 0; i < n; i++ {
+			r := math.Float32frombits(binary.LittleEndian.Uint32(input[8*i:]))
+			q := math.Float32frombits(binary.LittleEndian.Uint32(input[8*i+4:]))
+			output[i] = complex(r, q)
+		}
+	case CF64:
+		for i := 0; i < n; i++ {
+			r := math.Float64frombits(binary.LittleEndian.Uint64(input[16*i:]))
+			q := math.Float64frombits(binary.LittleEndian.Uint64(input[16*i+8:]))
+			output[i] = complex(float32(r), float32(q))
+		}
+	}
+
+	return n, nil
+}
+
+// Converts normalized samples into interleaved IQ components, returning the number of bytes written.
+// Integer formats are scaled back up to their full range and clipped
+func complexSliceToBytes(format SampleFormat, input []complex64, output []byte) int {
+	width := format.componentSize()
+	if width == 0 {
+		return 0
+	}
+	n := min(len(input), len(output)/(2*width))
+
+	switch format {
+	case CS8:
+		for i := 0; i < n; i++ {
+			output[2*i] = byte(int8(scaleComponent(real(input[i]), 127.0, math.MinInt8, math.MaxInt8)))
+			output[2*i+1] = byte(int8(scaleComponent(imag(input[i]), 127.0, math.MinInt8, math.MaxInt8)))
+		}
+	case CU8:
+		for i := 0; i < n; i++ {
+			output[2*i] = byte(scaleComponent(real(input[i])+1, 127.5, 0, math.MaxUint8))
+			output[2*i+1] = byte(scaleComponent(imag(input[i])+1, 127.5, 0, math.MaxUint8))
+		}
+	case CS16:
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint16(output[4*i:], uint16(int16(scaleComponent(real(input[i]), 32767.0, math.MinInt16, math.MaxInt16))))
+			binary.LittleEndian.PutUint16(output[4*i+2:], uint16(int16(scaleComponent(imag(input[i]), 32767.0, math.MinInt16, math.MaxInt16))))
+		}
+	case CF32:
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint32(output[8*i:], math.Float32bits(real(input[i])))
+			binary.LittleEndian.PutUint32(output[8*i+4:], math.Float32bits(imag(input[i])))
+		}
+	case CF64:
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint64(output[16*i:], math.Float64bits(float64(real(input[i]))))
+			binary.LittleEndian.PutUint64(output[16*i+8:], math.Float64bits(float64(imag(input[i]))))
+		}
+	}
+
+	return n * 2 * width
+}
+
+func scaleComponent(v float32, scale, lo, hi float64) float64 {
+	return max(lo, min(hi, math.Round(float64(v)*scale)))
+}
@@ -0,0 +1,156 @@
+package ziq
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrAnnotation error = fmt.Errorf("Could not parse ziq annotation")
+
+// Annotation keys written into segments cut out of a longer recording. The offsets are from the
+// start of the original recording, whose start time the segment keeps
+const (
+	SegmentOffsetKey        = "segment_offset"
+	SegmentOffsetSamplesKey = "segment_offset_samples"
+	SegmentIndexKey         = "segment_index"
+)
+
+// Recording metadata gathered from the ziq header and the JSON annotation SatDump writes into it
+type Metadata struct {
+	Format     SampleFormat `json:"format"`
+	SampleRate float64      `json:"sample_rate"`
+	// Sample rate claimed by the annotation, if any. This should match SampleRate
+	AnnotatedSampleRate float64 `json:"annotated_sample_rate,omitempty"`
+	// Center frequency of the recording in Hz
+	Frequency float64   `json:"frequency,omitempty"`
+	StartTime time.Time `json:"start_time,omitzero"`
+	// Offset of this recording into the one it was cut from, already added to StartTime
+	SegmentOffset time.Duration `json:"segment_offset,omitempty"`
+	Source        string        `json:"source,omitempty"`
+	// Every field of the annotation, including those not listed above
+	Raw map[string]any `json:"raw,omitempty"`
+}
+
+// Annotation keys we look for, in order of preference
+var (
+	frequencyKeys  = []string{"frequency", "center_frequency", "centerFrequency", "freq"}
+	timestampKeys  = []string{"timestamp", "start_time", "startTime", "time", "date"}
+	sampleRateKeys = []string{"samplerate", "sample_rate", "sampleRate"}
+	sourceKeys     = []string{"source", "source_type", "hardware", "device"}
+)
+
+// Parses the header annotation into Metadata. The header derived fields are filled in even when
+// the annotation is missing or can not be parsed, in which case ErrAnnotation is returned as well
+func (h ZiqHeader) Metadata() (Metadata, error) {
+	m := Metadata{
+		Format:     FormatForDepth(h.BitsPerSample),
+		SampleRate: float64(h.SampleRate),
+	}
+
+	annotation := strings.TrimSpace(h.Annotation)
+	if len(annotation) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal([]byte(annotation), &m.Raw); err != nil {
+		return m, fmt.Errorf("%w: %w", ErrAnnotation, err)
+	}
+
+	m.Frequency, _ = findNumber(m.Raw, frequencyKeys)
+	m.AnnotatedSampleRate, _ = findNumber(m.Raw, sampleRateKeys)
+	m.StartTime, _ = findTime(m.Raw, timestampKeys)
+	if offset, ok := findNumber(m.Raw, []string{SegmentOffsetKey}); ok {
+		m.SegmentOffset = time.Duration(offset * float64(time.Second))
+		if !m.StartTime.IsZero() {
+			m.StartTime = m.StartTime.Add(m.SegmentOffset)
+		}
+	}
+	for _, key := range sourceKeys {
+		if v, ok := m.Raw[key].(string); ok {
+			m.Source = v
+			break
+		}
+	}
+	return m, nil
+}
+
+// Returns a copy of the JSON annotation with the given fields added. Annotations that are not a
+// JSON object are kept under an "annotation" key
+func MergeAnnotation(annotation string, fields map[string]any) string {
+	merged := map[string]any{}
+	if trimmed := strings.TrimSpace(annotation); len(trimmed) > 0 {
+		if err := json.Unmarshal([]byte(trimmed), &merged); err != nil {
+			merged = map[string]any{"annotation": annotation}
+		}
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	data, _ := json.Marshal(merged)
+	return string(data)
+}
+
+// Returns a copy of annotation marking it as a segment starting offsetSamples into the original
+// recording
+func SegmentAnnotation(annotation string, index int, offsetSamples int64, sampleRate float64) string {
+	fields := map[string]any{
+		SegmentIndexKey:         index,
+		SegmentOffsetSamplesKey: offsetSamples,
+	}
+	if sampleRate > 0 {
+		fields[SegmentOffsetKey] = float64(offsetSamples) / sampleRate
+	}
+	return MergeAnnotation(annotation, fields)
+}
+
+// Returns the absolute time of the given sample, if the recording has a start time
+func (m Metadata) SampleTime(sample int64) (time.Time, bool) {
+	if m.StartTime.IsZero() || m.SampleRate == 0 {
+		return time.Time{}, false
+	}
+	offset := time.Duration(float64(sample) / m.SampleRate * float64(time.Second))
+	return m.StartTime.Add(offset), true
+}
+
+func findNumber(raw map[string]any, keys []string) (float64, bool) {
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case float64:
+			return v, true
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func findTime(raw map[string]any, keys []string) (time.Time, bool) {
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case float64:
+			return unixTime(v), true
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return unixTime(f), true
+			}
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Converts a unix timestamp in seconds, or milliseconds for large values, to a time
+func unixTime(v float64) time.Time {
+	if v > 1e12 {
+		v /= 1000
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,279 @@
+package ziq
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrNotSeekable error = fmt.Errorf("IQ source can only seek forward")
+
+// Reads headerless interleaved IQ samples, such as the output of rtl_sdr. WAV and SigMF recordings
+// are read with a RawReader as well, once their headers have been parsed
+type RawReader struct {
+	sampleFormat SampleFormat
+	sampleRate   float64
+	metadata     Metadata
+	r            io.Reader
+	closer       io.Closer
+	// Byte range holding the samples. dataSize is negative when the samples run to the end of r
+	dataOffset int64
+	dataSize   int64
+	pos        int64
+	buf        []byte
+	Done       bool
+}
+
+// Returns a RawReader for the samples in r, starting at its current position. Closing the RawReader
+// does not close r
+func NewRawReader(r io.Reader, format SampleFormat, sampleRate float64) (*RawReader, error) {
+	if format.componentSize() == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	raw := RawReader{
+		sampleFormat: format,
+		sampleRate:   sampleRate,
+		metadata:     Metadata{Format: format, SampleRate: sampleRate},
+		r:            r,
+		dataSize:     -1,
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			raw.dataOffset = offset
+		}
+	}
+	return &raw, nil
+}
+
+// Opens a headerless IQ file. Raw files do not record their sample rate, so it must be given
+func OpenRaw(path string, format SampleFormat, sampleRate float64) (*RawReader, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("A sample rate is required to read raw IQ file %s", path)
+	}
+	log.Debugf("Opening raw %s IQ file: %s", format, path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open IQ file %s: %w", path, err)
+	}
+	raw, err := NewRawReader(f, format, sampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	raw.closer = f
+	return raw, nil
+}
+
+func (r *RawReader) format() SampleFormat {
+	return r.sampleFormat
+}
+
+// Fills data with raw sample bytes, returning the number of bytes read. Follows the same end of
+// stream rules as ReadSamples
+func (r *RawReader) readBody(data []byte) (int, error) {
+	if r.Done {
+		return 0, io.EOF
+	}
+
+	sampleSize := r.sampleFormat.SampleSize()
+	if r.dataSize >= 0 {
+		remaining := r.dataSize - r.pos*int64(sampleSize)
+		data = data[:min(int64(len(data)), max(remaining, 0))]
+	}
+
+	read, err := io.ReadFull(r.r, data)
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("Could not read IQ data: %w", err)
+		}
+		r.Done = true
+	} else if len(data) == 0 {
+		r.Done = true
+	}
+
+	r.pos += int64(read / sampleSize)
+	if read%sampleSize != 0 {
+		return read, ErrTruncated
+	}
+	if read == 0 && r.Done {
+		return 0, io.EOF
+	}
+	return read, nil
+}
+
+// Reads up to len(dst) samples into dst. Returns io.EOF once the samples have been fully read, and
+// ErrTruncated if they end partway through a sample
+func (r *RawReader) ReadSamples(dst []complex64) (int, error) {
+	if r.Done {
+		return 0, io.EOF
+	}
+
+	sampleSize := r.sampleFormat.SampleSize()
+	if cap(r.buf) < len(dst)*sampleSize {
+		r.buf = make([]byte, len(dst)*sampleSize)
+	}
+	data := r.buf[:len(dst)*sampleSize]
+
+	read, err := r.readBody(data)
+	n, _ := bytesToComplexSlice(r.sampleFormat, data[:read], dst, true)
+	return n, err
+}
+
+func (r *RawReader) SampleRate() float64 {
+	return r.sampleRate
+}
+
+func (r *RawReader) Metadata() (Metadata, error) {
+	return r.metadata, nil
+}
+
+// Returns the number of samples read (or skipped with Seek) so far
+func (r *RawReader) Position() int64 {
+	return r.pos
+}
+
+// Returns the total number of samples, if the length of the underlying reader is known
+func (r *RawReader) NumSamples() (int64, error) {
+	size := r.dataSize
+	if size < 0 {
+		seeker, ok := r.r.(io.Seeker)
+		if !ok {
+			return 0, fmt.Errorf("Length of IQ stream is unknown")
+		}
+		current, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+			return 0, err
+		}
+		size = end - r.dataOffset
+	}
+	return size / int64(r.sampleFormat.SampleSize()), nil
+}
+
+// Moves the read position to the given time from the start of the samples
+func (r *RawReader) SeekTime(t time.Duration) error {
+	if r.sampleRate == 0 {
+		return fmt.Errorf("Can not seek by time; IQ source has no sample rate")
+	}
+	_, err := r.Seek(int64(t.Seconds()*r.sampleRate), io.SeekStart)
+	return err
+}
+
+// Moves the read position like io.Seeker, except that offsets are counted in samples rather than
+// bytes. Readers that can not seek are read forward and the samples thrown away
+func (r *RawReader) Seek(offset int64, whence int) (int64, error) {
+	sampleOffset := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		sampleOffset += r.pos
+	case io.SeekEnd:
+		total, err := r.NumSamples()
+		if err != nil {
+			return r.pos, err
+		}
+		sampleOffset += total
+	default:
+		return r.pos, fmt.Errorf("Invalid seek whence %d", whence)
+	}
+	if sampleOffset < 0 {
+		return r.pos, fmt.Errorf("%w: %d", ErrSeekRange, sampleOffset)
+	}
+
+	sampleSize := int64(r.sampleFormat.SampleSize())
+	seeker, ok := r.r.(io.Seeker)
+	if !ok {
+		if sampleOffset < r.pos {
+			return r.pos, ErrNotSeekable
+		}
+		skipped, err := io.CopyN(io.Discard, r.r, (sampleOffset-r.pos)*sampleSize)
+		r.pos += skipped / sampleSize
+		if err != nil {
+			r.Done = true
+			return r.pos, fmt.Errorf("%w: %w", ErrSeekRange, err)
+		}
+		return r.pos, nil
+	}
+
+	if total, err := r.NumSamples(); err == nil && sampleOffset > total {
+		return r.pos, fmt.Errorf("%w: %d > %d", ErrSeekRange, sampleOffset, total)
+	}
+	if _, err := seeker.Seek(r.dataOffset+sampleOffset*sampleSize, io.SeekStart); err != nil {
+		return r.pos, fmt.Errorf("Could not seek IQ file: %w", err)
+	}
+	r.pos = sampleOffset
+	r.Done = false
+	return r.pos, nil
+}
+
+// Closes the underlying file, if the RawReader opened it
+func (r *RawReader) Close() error {
+	r.Done = true
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Writes headerless interleaved IQ samples
+type RawWriter struct {
+	sampleFormat SampleFormat
+	out          io.Writer
+	closer       io.Closer
+	buf          []byte
+}
+
+// Returns a RawWriter that writes samples to out. Closing the RawWriter does not close out
+func NewRawWriter(out io.Writer, format SampleFormat) (*RawWriter, error) {
+	if format.componentSize() == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	return &RawWriter{sampleFormat: format, out: out}, nil
+}
+
+// Creates a headerless IQ file at path
+func CreateRaw(path string, format SampleFormat) (*RawWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create IQ file %s: %w", path, err)
+	}
+	w, err := NewRawWriter(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+func (w *RawWriter) WriteSamples(samples []complex64) error {
+	size := len(samples) * w.sampleFormat.SampleSize()
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	data := w.buf[:size]
+	complexSliceToBytes(w.sampleFormat, samples, data)
+
+	if _, err := w.out.Write(data); err != nil {
+		return fmt.Errorf("Could not write IQ data: %w", err)
+	}
+	return nil
+}
+
+// Closes the underlying file, if the RawWriter created it
+func (w *RawWriter) Close() error {
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
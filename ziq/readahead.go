@@ -0,0 +1,207 @@
+package ziq
+
+import (
+	"io"
+	"sync"
+)
+
+// Decodes a sample source ahead of the consumer. For ziq bodies and other byte streams, one goroutine
+// reads and decompresses the body into a fixed set of byte buffers, and a second converts them into
+// sample chunks drawn from a free list, so that a steady stream of chunks does not allocate as long
+// as they are handed back with Release
+type ReadAhead struct {
+	src       SampleSource
+	body      byteSource
+	chunkSize int
+	free      chan []byte
+	raw       chan rawChunk
+	chunks    chan sampleChunk
+	spare     chan []complex64
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	// Whether Close has been called, and whether the source is being read from
+	lock    sync.Mutex
+	stopped bool
+	reading bool
+}
+
+type rawChunk struct {
+	data []byte
+	err  error
+}
+
+type sampleChunk struct {
+	samples []complex64
+	err     error
+}
+
+// Starts decoding chunks of chunkSize samples in the background, buffering up to depth chunks.
+// The source must not be read from directly until the ReadAhead is closed
+func StartReadAhead(src SampleSource, chunkSize, depth int) *ReadAhead {
+	depth = max(depth, 1)
+	r := &ReadAhead{
+		src:       src,
+		chunkSize: chunkSize,
+		free:      make(chan []byte, depth+1),
+		raw:       make(chan rawChunk, depth),
+		chunks:    make(chan sampleChunk, depth),
+		// Enough for every chunk that can be queued, being converted and being used by the caller
+		spare: make(chan []complex64, depth+2),
+		stop:  make(chan struct{}),
+	}
+
+	body, ok := src.(byteSource)
+	if !ok {
+		// Sources that only hand us samples are read and converted in one go
+		r.wg.Add(1)
+		go r.readSamples()
+		return r
+	}
+
+	r.body = body
+	byteSize := chunkSize * body.format().SampleSize()
+	for i := 0; i < depth+1; i++ {
+		r.free <- make([]byte, byteSize)
+	}
+
+	r.wg.Add(2)
+	go r.read()
+	go r.convert()
+	return r
+}
+
+func (r *ReadAhead) read() {
+	defer r.wg.Done()
+	defer close(r.raw)
+	for {
+		var buf []byte
+		select {
+		case buf = <-r.free:
+		case <-r.stop:
+			return
+		}
+
+		if !r.startRead() {
+			return
+		}
+		n, err := r.body.readBody(buf)
+		r.endRead()
+		select {
+		case r.raw <- rawChunk{data: buf[:n], err: err}:
+		case <-r.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *ReadAhead) convert() {
+	defer r.wg.Done()
+	defer close(r.chunks)
+	for raw := range r.raw {
+		var out []complex64
+		if len(raw.data) > 0 {
+			out = r.getChunk()
+			n, _ := bytesToComplexSlice(r.body.format(), raw.data, out, true)
+			out = out[:n]
+		}
+		r.free <- raw.data[:cap(raw.data)]
+
+		select {
+		case r.chunks <- sampleChunk{samples: out, err: raw.err}:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *ReadAhead) readSamples() {
+	defer r.wg.Done()
+	defer close(r.chunks)
+	for {
+		out := r.getChunk()
+		if !r.startRead() {
+			return
+		}
+		n, err := r.src.ReadSamples(out)
+		r.endRead()
+		out = out[:n]
+		if n == 0 {
+			r.Release(out)
+			out = nil
+		}
+
+		select {
+		case r.chunks <- sampleChunk{samples: out, err: err}:
+		case <-r.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Returns the next decoded chunk. The chunk belongs to the caller, who may hand it back with
+// Release once finished with it. Returns io.EOF once the body has been fully read
+func (r *ReadAhead) Next() ([]complex64, error) {
+	c, ok := <-r.chunks
+	if !ok {
+		return nil, io.EOF
+	}
+	return c.samples, c.err
+}
+
+// Returns a spare chunk, or a new one if none have been released
+func (r *ReadAhead) getChunk() []complex64 {
+	select {
+	case s := <-r.spare:
+		return s
+	default:
+		return make([]complex64, r.chunkSize)
+	}
+}
+
+// Hands a chunk from Next back to be reused. Chunks are dropped if there are enough spares already
+func (r *ReadAhead) Release(samples []complex64) {
+	if cap(samples) < r.chunkSize {
+		return
+	}
+	select {
+	case r.spare <- samples[:r.chunkSize]:
+	default:
+	}
+}
+
+// Marks the source as being read from, unless Close has been called
+func (r *ReadAhead) startRead() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reading = !r.stopped
+	return r.reading
+}
+
+func (r *ReadAhead) endRead() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reading = false
+}
+
+// Stops the background decoding. This does not close the underlying source. If a read from the
+// source is under way, such as one waiting on a network connection or stdin, Close returns
+// without waiting for it; whatever it reads is dropped, and closing the source ends it early.
+// Otherwise the source can be read from again once Close returns
+func (r *ReadAhead) Close() {
+	r.lock.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+	reading := r.reading
+	r.lock.Unlock()
+	if !reading {
+		r.wg.Wait()
+	}
+}
@@ -0,0 +1,146 @@
+package ziq
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Chunk size used by the benchmarks, as ziq2lrit reads by default
+const benchChunkSize = 1 << 16
+
+// Reads the same bytes over and over, so benchmarks can run for as long as they like without
+// allocating or touching the disk
+type loopReader struct {
+	data []byte
+	off  int
+}
+
+func (l *loopReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], l.data[l.off:])
+		n += copied
+		l.off = (l.off + copied) % len(l.data)
+	}
+	return n, nil
+}
+
+// Returns an endless source of the given format, repeating a few chunks worth of test samples
+func loopSource(b *testing.B, format SampleFormat) *RawReader {
+	b.Helper()
+	samples := testSamples(4 * benchChunkSize)
+	data := make([]byte, len(samples)*format.SampleSize())
+	complexSliceToBytes(format, samples, data)
+	r, err := NewRawReader(&loopReader{data: data}, format, 2048000)
+	if err != nil {
+		b.Fatalf("NewRawReader: %s", err)
+	}
+	return r
+}
+
+func reportSampleRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)*benchChunkSize/b.Elapsed().Seconds(), "samples/s")
+}
+
+func BenchmarkReadSamples(b *testing.B) {
+	for _, format := range []SampleFormat{CS8, CS16, CF32} {
+		b.Run(string(format), func(b *testing.B) {
+			src := loopSource(b, format)
+			dst := make([]complex64, benchChunkSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := src.ReadSamples(dst); err != nil {
+					b.Fatalf("ReadSamples: %s", err)
+				}
+			}
+			reportSampleRate(b)
+		})
+	}
+}
+
+func BenchmarkReadAhead(b *testing.B) {
+	for _, format := range []SampleFormat{CS8, CS16, CF32} {
+		b.Run(string(format), func(b *testing.B) {
+			b.ReportAllocs()
+			reader := StartReadAhead(loopSource(b, format), benchChunkSize, 4)
+			defer reader.Close()
+			// Hold on to every chunk the reader can have out at once, so the spares are all made
+			// before timing starts
+			held := make([][]complex64, 8)
+			for i := range held {
+				held[i], _ = reader.Next()
+			}
+			for _, samples := range held {
+				reader.Release(samples)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				samples, err := reader.Next()
+				if err != nil {
+					b.Fatalf("Next: %s", err)
+				}
+				reader.Release(samples)
+			}
+			reportSampleRate(b)
+		})
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	samples := testSamples(25000)
+	for _, compressed := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "test.ziq")
+		writeTestZiq(t, path, 16, compressed, 4096, 1, samples)
+		z, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load: %s", err)
+		}
+		reader := StartReadAhead(z, 3000, 2)
+		var got []complex64
+		for {
+			chunk, err := reader.Next()
+			got = append(got, chunk...)
+			reader.Release(chunk)
+			if err != nil {
+				break
+			}
+		}
+		reader.Close()
+		z.Close()
+		compareSamples(t, CS16, got, samples)
+	}
+}
+
+func TestReadAheadCloseWhileBlocked(t *testing.T) {
+	samples := testSamples(3000)
+	data := make([]byte, len(samples)*CS16.SampleSize())
+	complexSliceToBytes(CS16, samples, data)
+
+	// A stream that sends one chunk and then goes quiet, as a stalled connection would
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write(data)
+	src, err := NewRawReader(pr, CS16, 2048000)
+	if err != nil {
+		t.Fatalf("NewRawReader: %s", err)
+	}
+	reader := StartReadAhead(src, len(samples), 2)
+	chunk, err := reader.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+	compareSamples(t, CS16, chunk, samples)
+
+	closed := make(chan struct{})
+	go func() {
+		reader.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close is still waiting on the blocked read")
+	}
+}
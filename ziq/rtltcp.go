@@ -0,0 +1,260 @@
+package ziq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrRTLTCP error = fmt.Errorf("Invalid rtl_tcp stream")
+
+// rtl_tcp commands; each is sent as the command byte followed by a big endian uint32 parameter
+const (
+	rtltcpSetFrequency  = 0x01
+	rtltcpSetSampleRate = 0x02
+)
+
+const (
+	DefaultStallTimeout   = 5 * time.Second
+	maxRTLTCPReconnectGap = 30 * time.Second
+)
+
+// Streams cu8 samples from an rtl_tcp compatible server. When the stream stalls or the connection
+// drops, the source reconnects and carries on; samples sent while disconnected are lost
+type RTLTCPSource struct {
+	addr       string
+	sampleRate float64
+	frequency  float64
+	started    time.Time
+	// How long a read may block before the stream is considered stalled
+	StallTimeout time.Duration
+	// Number of reconnect attempts before giving up, or 0 to retry forever
+	MaxReconnects int
+	connLock      sync.Mutex
+	conn          net.Conn
+	closed        chan struct{}
+	closeOnce     sync.Once
+	pos           int64
+	buf           []byte
+	Done          bool
+}
+
+// Connects to the rtl_tcp server at addr, and asks it for the given sample rate. A frequency of
+// 0 leaves the server tuned wherever it already is
+func DialRTLTCP(addr string, sampleRate, frequency float64) (*RTLTCPSource, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("A sample rate is required to stream from rtl_tcp")
+	}
+	s := RTLTCPSource{
+		addr:         addr,
+		sampleRate:   sampleRate,
+		frequency:    frequency,
+		started:      time.Now().UTC(),
+		StallTimeout: DefaultStallTimeout,
+		closed:       make(chan struct{}),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *RTLTCPSource) connect() error {
+	log.Debugf("Connecting to rtl_tcp server %s", s.addr)
+	conn, err := net.DialTimeout("tcp", s.addr, s.StallTimeout)
+	if err != nil {
+		return fmt.Errorf("Could not connect to rtl_tcp server %s: %w", s.addr, err)
+	}
+
+	// The server greets us with "RTL0", the tuner type and the number of gain steps
+	conn.SetReadDeadline(time.Now().Add(s.StallTimeout))
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		conn.Close()
+		return fmt.Errorf("%w: could not read header from %s: %w", ErrRTLTCP, s.addr, err)
+	}
+	if string(header[0:4]) != "RTL0" {
+		conn.Close()
+		return fmt.Errorf("%w: %s did not send an RTL0 header", ErrRTLTCP, s.addr)
+	}
+	log.Debugf("rtl_tcp tuner type %d with %d gain steps", binary.BigEndian.Uint32(header[4:8]), binary.BigEndian.Uint32(header[8:12]))
+
+	if err := sendRTLTCPCommand(conn, rtltcpSetSampleRate, uint32(s.sampleRate)); err != nil {
+		conn.Close()
+		return err
+	}
+	if s.frequency > 0 {
+		if err := sendRTLTCPCommand(conn, rtltcpSetFrequency, uint32(s.frequency)); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	select {
+	case <-s.closed:
+		conn.Close()
+		return io.EOF
+	default:
+	}
+	s.conn = conn
+	return nil
+}
+
+func sendRTLTCPCommand(conn net.Conn, command byte, param uint32) error {
+	cmd := []byte{command, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(cmd[1:], param)
+	if _, err := conn.Write(cmd); err != nil {
+		return fmt.Errorf("Could not send rtl_tcp command %d: %w", command, err)
+	}
+	return nil
+}
+
+// Drops the current connection and dials again, backing off between attempts
+func (s *RTLTCPSource) reconnect() error {
+	s.dropConn()
+	delay := time.Second
+	for attempt := 1; s.MaxReconnects == 0 || attempt <= s.MaxReconnects; attempt++ {
+		select {
+		case <-s.closed:
+			return io.EOF
+		case <-time.After(delay):
+		}
+		err := s.connect()
+		if err == nil {
+			log.Infof("Reconnected to rtl_tcp server %s", s.addr)
+			return nil
+		} else if err == io.EOF {
+			return err
+		}
+		delay = min(2*delay, maxRTLTCPReconnectGap)
+		log.Warnf("%s; retrying in %s", err.Error(), delay)
+	}
+	return fmt.Errorf("Gave up reconnecting to rtl_tcp server %s", s.addr)
+}
+
+func (s *RTLTCPSource) dropConn() {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *RTLTCPSource) currentConn() net.Conn {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	return s.conn
+}
+
+func (s *RTLTCPSource) format() SampleFormat {
+	return CU8
+}
+
+// Fills data with samples from the server. Blocks across stalls and reconnects until data is full,
+// the source is closed, or reconnecting fails
+func (s *RTLTCPSource) readBody(data []byte) (int, error) {
+	if s.Done {
+		return 0, io.EOF
+	}
+
+	sampleSize := CU8.SampleSize()
+	data = data[:len(data)-len(data)%sampleSize]
+	filled := 0
+	for filled < len(data) {
+		conn := s.currentConn()
+		if conn == nil {
+			if err := s.reconnect(); err != nil {
+				s.Done = true
+				filled -= filled % sampleSize
+				s.pos += int64(filled / sampleSize)
+				if filled > 0 && err == io.EOF {
+					return filled, nil
+				}
+				return filled, err
+			}
+			continue
+		}
+
+		conn.SetReadDeadline(time.Now().Add(s.StallTimeout))
+		n, err := conn.Read(data[filled:])
+		filled += n
+		if err != nil {
+			select {
+			case <-s.closed:
+				continue
+			default:
+			}
+			log.Warnf("Lost rtl_tcp stream from %s: %s; reconnecting", s.addr, err.Error())
+			s.dropConn()
+			// A new connection starts on a sample boundary, so throw away any half sample
+			filled -= filled % sampleSize
+		}
+	}
+
+	s.pos += int64(filled / sampleSize)
+	return filled, nil
+}
+
+// Reads len(dst) samples into dst, returning io.EOF once the source is closed
+func (s *RTLTCPSource) ReadSamples(dst []complex64) (int, error) {
+	size := len(dst) * CU8.SampleSize()
+	if cap(s.buf) < size {
+		s.buf = make([]byte, size)
+	}
+	data := s.buf[:size]
+
+	read, err := s.readBody(data)
+	n, _ := bytesToComplexSlice(CU8, data[:read], dst, true)
+	return n, err
+}
+
+func (s *RTLTCPSource) SampleRate() float64 {
+	return s.sampleRate
+}
+
+// Metadata for a live stream; the start time is when we first connected
+func (s *RTLTCPSource) Metadata() (Metadata, error) {
+	return Metadata{
+		Format:     CU8,
+		SampleRate: s.sampleRate,
+		Frequency:  s.frequency,
+		StartTime:  s.started,
+		Source:     "rtl_tcp " + s.addr,
+	}, nil
+}
+
+// Returns the number of samples received so far
+func (s *RTLTCPSource) Position() int64 {
+	return s.pos
+}
+
+// Throws away the given amount of the live stream
+func (s *RTLTCPSource) SeekTime(t time.Duration) error {
+	skip := int64(t.Seconds()*s.sampleRate) * int64(CU8.SampleSize())
+	buf := make([]byte, 64*1024)
+	for skip > 0 {
+		n, err := s.readBody(buf[:min(int64(len(buf)), skip)])
+		skip -= int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Disconnects from the server. Any blocked read returns io.EOF
+func (s *RTLTCPSource) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	s.dropConn()
+	return nil
+}
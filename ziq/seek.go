@@ -0,0 +1,413 @@
+package ziq
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/DataDog/zstd"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	zstdFrameMagic        = 0xFD2FB528
+	zstdSkippableMagic    = 0x184D2A50
+	zstdSkippableMagicMsk = 0xFFFFFFF0
+)
+
+var ErrSeekRange error = fmt.Errorf("Seek offset is outside of the ziq recording")
+
+// Describes where each zstd frame of a compressed ziq body starts, so that we can begin
+// decompressing at the frame containing a given sample instead of at the start of the body
+type FrameIndex struct {
+	BodySize   int64        `json:"body_size"`
+	ModTime    time.Time    `json:"mod_time"`
+	NumSamples int64        `json:"num_samples"`
+	Frames     []FrameEntry `json:"frames"`
+}
+
+type FrameEntry struct {
+	// Offset of the frame from the start of the ziq body
+	Offset int64 `json:"offset"`
+	// Index of the first sample decompressed from this frame
+	FirstSample int64 `json:"first_sample"`
+}
+
+// Path of the frame index sidecar cached next to a ziq file
+func IndexPath(path string) string {
+	return path + ".zidx"
+}
+
+func (z *Ziq) format() SampleFormat {
+	return FormatForDepth(z.Header.BitsPerSample)
+}
+
+func (z *Ziq) sampleSize() int64 {
+	return int64(z.format().SampleSize())
+}
+
+// Returns the size in bytes of the (possibly compressed) body following the header
+func (z *Ziq) BodySize() (int64, error) {
+	info, err := z.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size() - z.bodyOffset, nil
+}
+
+// Returns the number of samples read (or skipped with Seek) so far
+func (z *Ziq) Position() int64 {
+	return z.pos
+}
+
+// Returns the total number of samples in the recording. For compressed bodies this needs the
+// frame index, which is built in memory on first use unless there is a current sidecar
+func (z *Ziq) NumSamples() (int64, error) {
+	if !z.Header.Compressed {
+		info, err := z.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return (info.Size() - z.bodyOffset) / z.sampleSize(), nil
+	}
+
+	idx, err := z.FrameIndex()
+	if err != nil {
+		return 0, err
+	}
+	return idx.NumSamples, nil
+}
+
+// Moves the read position to the given time from the start of the recording
+func (z *Ziq) SeekTime(t time.Duration) error {
+	if z.Header.SampleRate == 0 {
+		return fmt.Errorf("Can not seek by time; ziq header has no sample rate")
+	}
+	_, err := z.Seek(int64(t.Seconds()*float64(z.Header.SampleRate)), io.SeekStart)
+	return err
+}
+
+// Moves the read position like io.Seeker, except that offsets are counted in samples rather
+// than bytes. Returns the new sample position
+func (z *Ziq) Seek(offset int64, whence int) (int64, error) {
+	sampleOffset := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		sampleOffset += z.pos
+	case io.SeekEnd:
+		total, err := z.NumSamples()
+		if err != nil {
+			return z.pos, err
+		}
+		sampleOffset += total
+	default:
+		return z.pos, fmt.Errorf("Invalid seek whence %d", whence)
+	}
+
+	if sampleOffset < 0 {
+		return z.pos, fmt.Errorf("%w: %d", ErrSeekRange, sampleOffset)
+	}
+	if err := z.seekSample(sampleOffset); err != nil {
+		return z.pos, err
+	}
+	return z.pos, nil
+}
+
+func (z *Ziq) seekSample(sampleOffset int64) error {
+	if !z.Header.Compressed {
+		if total, err := z.NumSamples(); err == nil && sampleOffset > total {
+			return fmt.Errorf("%w: %d > %d", ErrSeekRange, sampleOffset, total)
+		}
+		if _, err := z.file.Seek(z.bodyOffset+sampleOffset*z.sampleSize(), io.SeekStart); err != nil {
+			return fmt.Errorf("Could not seek ziq file: %w", err)
+		}
+		z.pos = sampleOffset
+		z.Done = false
+		return nil
+	}
+
+	idx, err := z.FrameIndex()
+	if err != nil {
+		return err
+	}
+	if sampleOffset > idx.NumSamples {
+		return fmt.Errorf("%w: %d > %d", ErrSeekRange, sampleOffset, idx.NumSamples)
+	}
+
+	// Find the last frame that begins at or before our sample
+	frame := FrameEntry{}
+	for _, f := range idx.Frames {
+		if f.FirstSample > sampleOffset {
+			break
+		}
+		frame = f
+	}
+
+	body, err := z.compressedBody()
+	if err != nil {
+		return fmt.Errorf("Could not seek ziq file: %w", err)
+	}
+	z.decoder.Close()
+	z.decoder = newFrameReader(body, frame.Offset)
+	z.Done = false
+
+	// Decompress and throw away everything in the frame before our sample
+	skip := (sampleOffset - frame.FirstSample) * z.sampleSize()
+	if _, err := io.CopyN(io.Discard, z.decoder, skip); err != nil {
+		return fmt.Errorf("Could not seek ziq file: %w", err)
+	}
+	z.pos = sampleOffset
+	return nil
+}
+
+// Returns a reader over the compressed body, which reads independently of the file position
+func (z *Ziq) compressedBody() (*io.SectionReader, error) {
+	size, err := z.BodySize()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(z.file, z.bodyOffset, size), nil
+}
+
+// Returns the frame index for a compressed ziq body. The index is loaded from the sidecar file if
+// there is one and it is still current, otherwise it is built by scanning the body. Either way it
+// is kept in memory, and nothing is written; see WriteFrameIndex
+func (z *Ziq) FrameIndex() (*FrameIndex, error) {
+	if !z.Header.Compressed {
+		return nil, fmt.Errorf("Ziq body is not compressed, and has no frame index")
+	}
+	if z.index != nil {
+		return z.index, nil
+	}
+
+	info, err := z.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	bodySize := info.Size() - z.bodyOffset
+
+	if data, err := os.ReadFile(IndexPath(z.path)); err == nil {
+		var idx FrameIndex
+		if err := json.Unmarshal(data, &idx); err == nil && idx.BodySize == bodySize && idx.ModTime.Equal(info.ModTime()) {
+			log.Debugf("Using cached ziq frame index %s", IndexPath(z.path))
+			z.index = &idx
+			return z.index, nil
+		}
+		log.Debugf("Ziq frame index %s is stale; rebuilding", IndexPath(z.path))
+	}
+
+	idx, err := buildFrameIndex(io.NewSectionReader(z.file, z.bodyOffset, bodySize), z.sampleSize())
+	if err != nil {
+		return nil, err
+	}
+	idx.BodySize = bodySize
+	idx.ModTime = info.ModTime()
+	z.index = idx
+	return z.index, nil
+}
+
+// Writes the frame index to the sidecar file next to the recording, building it first if need
+// be, so that later readers of the recording can seek into it without scanning the body
+func (z *Ziq) WriteFrameIndex() error {
+	idx, err := z.FrameIndex()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(IndexPath(z.path), data, os.FileMode(0644)); err != nil {
+		return fmt.Errorf("Could not write ziq frame index: %w", err)
+	}
+	return nil
+}
+
+// Walks the zstd frames in body, recording where each one starts and how many samples it holds
+func buildFrameIndex(body *io.SectionReader, sampleSize int64) (*FrameIndex, error) {
+	log.Debugf("Building ziq frame index")
+	idx := FrameIndex{}
+	var offset, decompressed int64
+
+	for offset < body.Size() {
+		var magic uint32
+		if err := binary.Read(io.NewSectionReader(body, offset, 4), binary.LittleEndian, &magic); err != nil {
+			return nil, fmt.Errorf("%w: could not read zstd frame at %d", ErrTruncated, offset)
+		}
+
+		if magic&zstdSkippableMagicMsk == zstdSkippableMagic {
+			var size uint32
+			if err := binary.Read(io.NewSectionReader(body, offset+4, 4), binary.LittleEndian, &size); err != nil {
+				return nil, fmt.Errorf("%w: could not read skippable frame at %d", ErrTruncated, offset)
+			}
+			offset += 8 + int64(size)
+			continue
+		}
+		if magic != zstdFrameMagic {
+			return nil, fmt.Errorf("Invalid zstd frame magic %#x at body offset %d", magic, offset)
+		}
+
+		// Recordings that were cut off while being written end in a partial frame; index whatever
+		// can still be decompressed from it
+		truncated := false
+		frameLen, err := zstdFrameLength(body, offset)
+		if errors.Is(err, ErrTruncated) {
+			log.Warnf("Ziq body ends in a truncated zstd frame at %d", offset)
+			frameLen = body.Size() - offset
+			truncated = true
+		} else if err != nil {
+			return nil, err
+		}
+
+		// We need the decompressed length of the frame to know which samples it holds
+		n, err := io.Copy(io.Discard, zstd.NewReader(io.NewSectionReader(body, offset, frameLen)))
+		if err != nil && !truncated {
+			return nil, fmt.Errorf("Could not decompress zstd frame at %d: %w", offset, err)
+		}
+
+		idx.Frames = append(idx.Frames, FrameEntry{Offset: offset, FirstSample: decompressed / sampleSize})
+		decompressed += n
+		offset += frameLen
+		if truncated {
+			break
+		}
+	}
+	idx.NumSamples = decompressed / sampleSize
+	log.Debugf("Indexed %d zstd frames holding %d samples", len(idx.Frames), idx.NumSamples)
+	return &idx, nil
+}
+
+// Returns the compressed length of the zstd frame starting at offset, by walking its block headers
+func zstdFrameLength(body *io.SectionReader, offset int64) (int64, error) {
+	hdr := make([]byte, 5)
+	if _, err := body.ReadAt(hdr, offset); err != nil {
+		return 0, fmt.Errorf("%w: zstd frame header at %d", ErrTruncated, offset)
+	}
+
+	descriptor := hdr[4]
+	fcsFlag := descriptor >> 6
+	singleSegment := (descriptor>>5)&1 == 1
+	hasChecksum := (descriptor>>2)&1 == 1
+	dictIDSize := []int64{0, 1, 2, 4}[descriptor&3]
+	fcsSize := []int64{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+	windowSize := int64(1)
+	if singleSegment {
+		windowSize = 0
+	}
+
+	pos := offset + 5 + windowSize + dictIDSize + fcsSize
+	blockHdr := make([]byte, 3)
+	for {
+		if _, err := body.ReadAt(blockHdr, pos); err != nil {
+			return 0, fmt.Errorf("%w: zstd block header at %d", ErrTruncated, pos)
+		}
+		bh := uint32(blockHdr[0]) | uint32(blockHdr[1])<<8 | uint32(blockHdr[2])<<16
+		last := bh&1 == 1
+		blockType := (bh >> 1) & 3
+		blockSize := int64(bh >> 3)
+		pos += 3
+
+		switch blockType {
+		case 0, 2:
+			// Raw and compressed blocks
+			pos += blockSize
+		case 1:
+			// RLE blocks hold a single byte
+			pos += 1
+		default:
+			return 0, fmt.Errorf("Invalid zstd block type at %d", pos-3)
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if hasChecksum {
+		pos += 4
+	}
+	if pos > body.Size() {
+		return 0, fmt.Errorf("%w: zstd frame at %d runs past end of file", ErrTruncated, offset)
+	}
+	return pos - offset, nil
+}
+
+// Decompresses a zstd body one frame at a time, from the frame at offset on. The zstd reader
+// gives up with io.ErrUnexpectedEOF if its input runs out while it still has more than one frame
+// buffered, which would drop the last frames of a recording, so each frame gets a reader of its
+// own
+type frameReader struct {
+	body   *io.SectionReader
+	offset int64
+	frame  io.ReadCloser
+}
+
+func newFrameReader(body *io.SectionReader, offset int64) *frameReader {
+	return &frameReader{body: body, offset: offset}
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	for {
+		if r.frame == nil {
+			if err := r.nextFrame(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.frame.Read(p)
+		if err == io.EOF {
+			r.frame.Close()
+			r.frame = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *frameReader) nextFrame() error {
+	for r.offset < r.body.Size() {
+		var magic uint32
+		if err := binary.Read(io.NewSectionReader(r.body, r.offset, 4), binary.LittleEndian, &magic); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if magic&zstdSkippableMagicMsk == zstdSkippableMagic {
+			var size uint32
+			if err := binary.Read(io.NewSectionReader(r.body, r.offset+4, 4), binary.LittleEndian, &size); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			r.offset += 8 + int64(size)
+			continue
+		}
+
+		frameLen, err := zstdFrameLength(r.body, r.offset)
+		if errors.Is(err, ErrTruncated) {
+			// Decompress what there is of a frame that was cut off, like any other reader would
+			frameLen = r.body.Size() - r.offset
+		} else if err != nil {
+			return err
+		}
+		r.frame = zstd.NewReader(io.NewSectionReader(r.body, r.offset, frameLen))
+		r.offset += frameLen
+		return nil
+	}
+	return io.EOF
+}
+
+func (r *frameReader) Close() error {
+	if r.frame == nil {
+		return nil
+	}
+	err := r.frame.Close()
+	r.frame = nil
+	return err
+}
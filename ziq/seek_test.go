@@ -0,0 +1,186 @@
+package ziq
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A sample source that can be moved around in, as both Ziq and RawReader are
+type seekableSource interface {
+	SampleSource
+	Seek(offset int64, whence int) (int64, error)
+}
+
+// Reads n samples from the current position, failing the test if fewer are read
+func readN(t *testing.T, src SampleSource, n int) []complex64 {
+	t.Helper()
+	out := make([]complex64, n)
+	read := 0
+	for read < n {
+		got, err := src.ReadSamples(out[read:])
+		read += got
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("ReadSamples: %s", err)
+		}
+	}
+	return out[:read]
+}
+
+// Seeks around src, checking each landing position against the samples it was written from
+func checkSeeks(t *testing.T, src seekableSource, format SampleFormat, samples []complex64) {
+	total := int64(len(samples))
+	for _, tc := range []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+	}{
+		{"start", 0, io.SeekStart, 0},
+		{"inside the first frame", 1234, io.SeekStart, 1234},
+		{"on a frame boundary", 8192, io.SeekStart, 8192},
+		{"back from the end", -3000, io.SeekEnd, total - 3000},
+		{"backwards from here", -5000, io.SeekCurrent, total - 2990 - 5000},
+		{"forwards from here", 4500, io.SeekCurrent, total - 7980 + 4500},
+		{"end", 0, io.SeekEnd, total},
+	} {
+		pos, err := src.Seek(tc.offset, tc.whence)
+		if err != nil {
+			t.Fatalf("Seek to %s: %s", tc.name, err)
+		}
+		if pos != tc.want || src.Position() != tc.want {
+			t.Fatalf("Seek to %s landed on %d (position %d), want %d", tc.name, pos, src.Position(), tc.want)
+		}
+		// Reading moves the position along, which the SeekCurrent cases count from
+		n := min(10, int(total-tc.want))
+		compareSamples(t, format, readN(t, src, n), samples[tc.want:tc.want+int64(n)])
+	}
+
+	if _, err := src.Seek(total+1, io.SeekStart); !errors.Is(err, ErrSeekRange) {
+		t.Errorf("Seeking past the end returned %v, want ErrSeekRange", err)
+	}
+	if _, err := src.Seek(-1, io.SeekStart); !errors.Is(err, ErrSeekRange) {
+		t.Errorf("Seeking before the start returned %v, want ErrSeekRange", err)
+	}
+
+	// 10ms at 2048000 samples/s
+	if err := src.SeekTime(10 * time.Millisecond); err != nil {
+		t.Fatalf("SeekTime: %s", err)
+	}
+	compareSamples(t, format, readN(t, src, 100), samples[20480:20580])
+}
+
+func TestZiqSeek(t *testing.T) {
+	samples := testSamples(25000)
+	for _, bps := range []uint8{8, 16, 32} {
+		format := FormatForDepth(bps)
+		for _, tc := range []struct {
+			name         string
+			compressed   bool
+			frameSamples int64
+		}{
+			{"raw", false, DefaultFrameSamples},
+			{"single frame", true, 0},
+			{"framed", true, 4096},
+		} {
+			t.Run(string(format)+"/"+tc.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "test.ziq")
+				writeTestZiq(t, path, bps, tc.compressed, tc.frameSamples, 1, samples)
+				z, err := Load(path)
+				if err != nil {
+					t.Fatalf("Load: %s", err)
+				}
+				defer z.Close()
+				checkSeeks(t, z, format, samples)
+
+				// Seeking only builds the index in memory, until it is asked to be written out
+				if _, err := os.Stat(IndexPath(path)); !errors.Is(err, fs.ErrNotExist) {
+					t.Fatalf("Seeking left a frame index behind: %v", err)
+				}
+				if tc.compressed {
+					if err := z.WriteFrameIndex(); err != nil {
+						t.Fatalf("WriteFrameIndex: %s", err)
+					}
+					if _, err := os.Stat(IndexPath(path)); err != nil {
+						t.Fatalf("No frame index written: %s", err)
+					}
+				}
+
+				// A fresh reader picks up the frame index written by the first
+				z2, err := Load(path)
+				if err != nil {
+					t.Fatalf("Load: %s", err)
+				}
+				defer z2.Close()
+				checkSeeks(t, z2, format, samples)
+			})
+		}
+	}
+}
+
+func TestRawSeek(t *testing.T) {
+	samples := testSamples(25000)
+	for _, format := range []SampleFormat{CS8, CS16, CF32, CF64, CU8} {
+		t.Run(string(format), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test."+string(format))
+			w, err := CreateRaw(path, format)
+			if err != nil {
+				t.Fatalf("CreateRaw: %s", err)
+			}
+			if err := w.WriteSamples(samples); err != nil {
+				t.Fatalf("WriteSamples: %s", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+
+			r, err := OpenRaw(path, format, 2048000)
+			if err != nil {
+				t.Fatalf("OpenRaw: %s", err)
+			}
+			defer r.Close()
+			tolerance := format
+			if format == CU8 {
+				// Offset binary rounds to the same steps as cs8, give or take half a step
+				tolerance = CS8
+			}
+			checkSeeks(t, r, tolerance, samples)
+		})
+	}
+}
+
+func TestRawSeekForwardOnly(t *testing.T) {
+	samples := testSamples(1000)
+	var buf bytes.Buffer
+	w, err := NewRawWriter(&buf, CF32)
+	if err != nil {
+		t.Fatalf("NewRawWriter: %s", err)
+	}
+	if err := w.WriteSamples(samples); err != nil {
+		t.Fatalf("WriteSamples: %s", err)
+	}
+	w.Close()
+
+	// Hide the Seek method of bytes.Reader
+	r, err := NewRawReader(struct{ io.Reader }{bytes.NewReader(buf.Bytes())}, CF32, 2048000)
+	if err != nil {
+		t.Fatalf("NewRawReader: %s", err)
+	}
+	if pos, err := r.Seek(300, io.SeekStart); err != nil || pos != 300 {
+		t.Fatalf("Seek forward returned %d, %v", pos, err)
+	}
+	compareSamples(t, CF32, readN(t, r, 10), samples[300:310])
+	if _, err := r.Seek(-20, io.SeekCurrent); !errors.Is(err, ErrNotSeekable) {
+		t.Errorf("Seeking backwards returned %v, want ErrNotSeekable", err)
+	}
+	if _, err := r.Seek(2000, io.SeekStart); !errors.Is(err, ErrSeekRange) {
+		t.Errorf("Seeking past the end returned %v, want ErrSeekRange", err)
+	}
+}
@@ -0,0 +1,155 @@
+package ziq
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrSigMF error = fmt.Errorf("Invalid SigMF recording")
+
+type sigmfMeta struct {
+	Global      map[string]any   `json:"global"`
+	Captures    []map[string]any `json:"captures"`
+	Annotations []map[string]any `json:"annotations"`
+}
+
+// Maps SigMF core:datatype values onto the formats we can read
+var sigmfDatatypes = map[string]SampleFormat{
+	"ci8":     CS8,
+	"ci8_le":  CS8,
+	"cu8":     CU8,
+	"cu8_le":  CU8,
+	"ci16_le": CS16,
+	"cf32_le": CF32,
+	"cf64_le": CF64,
+}
+
+// The core:datatype we write for each format
+var sigmfDatatypeNames = map[SampleFormat]string{
+	CS8:  "ci8",
+	CU8:  "cu8",
+	CS16: "ci16_le",
+	CF32: "cf32_le",
+	CF64: "cf64_le",
+}
+
+// Returns the .sigmf-meta and .sigmf-data paths for a recording named by either file, or by
+// neither extension
+func SigMFPaths(path string) (string, string) {
+	base := strings.TrimSuffix(strings.TrimSuffix(path, ".sigmf-meta"), ".sigmf-data")
+	base = strings.TrimSuffix(base, ".sigmf")
+	return base + ".sigmf-meta", base + ".sigmf-data"
+}
+
+// Opens a SigMF recording. path may name the .sigmf-meta file, the .sigmf-data file, or the
+// recording without an extension
+func OpenSigMF(path string) (*RawReader, error) {
+	metaPath, dataPath := SigMFPaths(path)
+	log.Debugf("Opening SigMF recording: %s", metaPath)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open SigMF metadata %s: %w", metaPath, err)
+	}
+	var meta sigmfMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrSigMF, metaPath, err)
+	}
+	metadata, err := meta.metadata()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrSigMF, metaPath, err)
+	}
+
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open SigMF data %s: %w", dataPath, err)
+	}
+	raw, err := NewRawReader(f, metadata.Format, metadata.SampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	raw.closer = f
+	raw.metadata = metadata
+	return raw, nil
+}
+
+func (s sigmfMeta) metadata() (Metadata, error) {
+	m := Metadata{Raw: s.Global}
+
+	datatype, _ := s.Global["core:datatype"].(string)
+	format, ok := sigmfDatatypes[datatype]
+	if !ok {
+		return m, fmt.Errorf("%w: core:datatype %q", ErrUnsupportedFormat, datatype)
+	}
+	if channels, ok := s.Global["core:num_channels"].(float64); ok && channels != 1 {
+		return m, fmt.Errorf("%d channel recordings are not supported", int(channels))
+	}
+	m.Format = format
+
+	m.SampleRate, ok = s.Global["core:sample_rate"].(float64)
+	if !ok {
+		return m, fmt.Errorf("missing core:sample_rate")
+	}
+	if hw, ok := s.Global["core:hw"].(string); ok {
+		m.Source = hw
+	} else if recorder, ok := s.Global["core:recorder"].(string); ok {
+		m.Source = recorder
+	}
+
+	// Only the first capture segment is used; later segments describe retunes partway through
+	if len(s.Captures) > 0 {
+		m.Frequency, _ = s.Captures[0]["core:frequency"].(float64)
+		if datetime, ok := s.Captures[0]["core:datetime"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, datetime); err == nil {
+				m.StartTime = t
+			}
+		}
+	}
+	return m, nil
+}
+
+// Creates a SigMF recording, writing its metadata straight away and returning a writer for its
+// samples. Fields of global are added to the global object alongside those taken from metadata
+func CreateSigMF(path string, format SampleFormat, metadata Metadata, global map[string]any) (*RawWriter, error) {
+	datatype, ok := sigmfDatatypeNames[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s can not be stored in a SigMF recording", ErrUnsupportedFormat, format)
+	}
+	metaPath, dataPath := SigMFPaths(path)
+
+	meta := sigmfMeta{
+		Global: map[string]any{
+			"core:datatype":    datatype,
+			"core:sample_rate": metadata.SampleRate,
+			"core:version":     "1.0.0",
+		},
+		Captures:    []map[string]any{{"core:sample_start": 0}},
+		Annotations: []map[string]any{},
+	}
+	if len(metadata.Source) > 0 {
+		meta.Global["core:hw"] = metadata.Source
+	}
+	for key, value := range global {
+		meta.Global[key] = value
+	}
+	if metadata.Frequency != 0 {
+		meta.Captures[0]["core:frequency"] = metadata.Frequency
+	}
+	if !metadata.StartTime.IsZero() {
+		meta.Captures[0]["core:datetime"] = metadata.StartTime.UTC().Format(time.RFC3339Nano)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode SigMF metadata: %w", err)
+	}
+	if err := os.WriteFile(metaPath, data, os.FileMode(0644)); err != nil {
+		return nil, fmt.Errorf("Could not write SigMF metadata %s: %w", metaPath, err)
+	}
+	return CreateRaw(dataPath, format)
+}
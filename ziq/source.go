@@ -0,0 +1,99 @@
+package ziq
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// A stream of IQ samples, such as a ziq recording or a raw IQ file
+type SampleSource interface {
+	// Reads up to len(dst) normalized samples into dst, returning io.EOF once the stream ends
+	ReadSamples(dst []complex64) (int, error)
+	SampleRate() float64
+	Metadata() (Metadata, error)
+	// Returns the number of samples read (or skipped) so far
+	Position() int64
+	SeekTime(t time.Duration) error
+	Close() error
+}
+
+// Anything samples can be written out to, such as a ziq Writer or a RawWriter
+type SampleWriter interface {
+	// Writes normalized samples
+	WriteSamples(samples []complex64) error
+	Close() error
+}
+
+// Sources that read fixed size samples from a byte stream. ReadAhead uses this to convert samples
+// on a separate goroutine from the one doing the reading
+type byteSource interface {
+	format() SampleFormat
+	readBody(data []byte) (int, error)
+}
+
+// Opens an IQ recording. format is one of ziq, wav, sigmf, or a raw sample format such as cs16;
+// when empty it is guessed from the file extension. A path of "-" reads raw samples from stdin,
+// as cu8 unless told otherwise. sampleRate is only used for raw files, which do not record it
+func Open(path string, format string, sampleRate float64) (SampleSource, error) {
+	if path == "-" {
+		return openStdin(format, sampleRate)
+	}
+	if len(format) == 0 {
+		format = FormatForPath(path)
+		if len(format) == 0 {
+			return nil, fmt.Errorf("Could not tell the format of %s from its extension", path)
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "ziq":
+		return Load(path)
+	case "wav":
+		return OpenWAV(path)
+	case "sigmf":
+		return OpenSigMF(path)
+	default:
+		sampleFormat, err := ParseSampleFormat(format)
+		if err != nil {
+			return nil, err
+		}
+		return OpenRaw(path, sampleFormat, sampleRate)
+	}
+}
+
+func openStdin(format string, sampleRate float64) (SampleSource, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("A sample rate is required to read IQ samples from stdin")
+	}
+	sampleFormat := CU8
+	if len(format) > 0 {
+		var err error
+		if sampleFormat, err = ParseSampleFormat(format); err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("Reading %s IQ samples from stdin", sampleFormat)
+	return NewRawReader(bufio.NewReaderSize(os.Stdin, 1<<20), sampleFormat, sampleRate)
+}
+
+// Guesses the format of a recording from its file extension, returning "" if it is not one Open
+// knows how to read
+func FormatForPath(path string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch ext {
+	case "ziq", "wav", "sigmf":
+		return ext
+	case "sigmf-meta", "sigmf-data":
+		return "sigmf"
+	}
+	if _, err := ParseSampleFormat(ext); err == nil {
+		return ext
+	}
+	return ""
+}
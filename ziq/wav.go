@@ -0,0 +1,279 @@
+package ziq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var ErrWAV error = fmt.Errorf("Invalid IQ WAV file")
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// Opens a two channel WAV recording, as written by SDR# and SDR Console. The center frequency and
+// start time are read from the auxi chunk when there is one
+func OpenWAV(path string) (*RawReader, error) {
+	log.Debugf("Opening WAV IQ file: %s", path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open IQ file %s: %w", path, err)
+	}
+
+	raw, err := readWAVHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not open IQ file %s: %w", path, err)
+	}
+	raw.closer = f
+	return raw, nil
+}
+
+// Walks the RIFF chunks up to the data chunk, leaving f positioned at the first sample
+func readWAVHeader(f *os.File) (*RawReader, error) {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(f, riff); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%w: missing RIFF/WAVE signature", ErrWAV)
+	}
+
+	var format *wavFormat
+	metadata := Metadata{}
+	for {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(f, chunk); err != nil {
+			return nil, fmt.Errorf("%w: no data chunk", ErrWAV)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			body := make([]byte, size)
+			if _, err := io.ReadFull(f, body); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrTruncated, err)
+			}
+			format = &wavFormat{}
+			if _, err := binary.Decode(body, binary.LittleEndian, format); err != nil {
+				return nil, fmt.Errorf("%w: short fmt chunk", ErrWAV)
+			}
+			// WAVE_FORMAT_EXTENSIBLE keeps the real format code at the start of the sub format GUID
+			if format.AudioFormat == wavFormatExtensible && len(body) >= 26 {
+				format.AudioFormat = binary.LittleEndian.Uint16(body[24:26])
+			}
+		case "auxi":
+			body := make([]byte, size)
+			if _, err := io.ReadFull(f, body); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrTruncated, err)
+			}
+			metadata = parseAuxi(body)
+		case "data":
+			if format == nil {
+				return nil, fmt.Errorf("%w: data chunk comes before fmt chunk", ErrWAV)
+			}
+			sampleFormat, err := format.sampleFormat()
+			if err != nil {
+				return nil, err
+			}
+
+			raw, err := NewRawReader(f, sampleFormat, float64(format.SampleRate))
+			if err != nil {
+				return nil, err
+			}
+			// Streaming writers leave the size at 0 or 0xFFFFFFFF, so read to the end instead
+			if size != 0 && size != 0xFFFFFFFF {
+				raw.dataSize = size
+			}
+			metadata.Format = sampleFormat
+			metadata.SampleRate = raw.sampleRate
+			raw.metadata = metadata
+			return raw, nil
+		default:
+			log.Debugf("Skipping WAV chunk %q", id)
+		}
+
+		// Chunks are padded to an even length
+		if id != "fmt " && id != "auxi" {
+			if _, err := f.Seek(size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		if size%2 == 1 {
+			if _, err := f.Seek(1, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (w *wavFormat) sampleFormat() (SampleFormat, error) {
+	if w.Channels != 2 {
+		return "", fmt.Errorf("%w: %d channels; IQ recordings need 2", ErrWAV, w.Channels)
+	}
+	switch {
+	case w.AudioFormat == wavFormatPCM && w.BitsPerSample == 8:
+		return CU8, nil
+	case w.AudioFormat == wavFormatPCM && w.BitsPerSample == 16:
+		return CS16, nil
+	case w.AudioFormat == wavFormatFloat && w.BitsPerSample == 32:
+		return CF32, nil
+	case w.AudioFormat == wavFormatFloat && w.BitsPerSample == 64:
+		return CF64, nil
+	default:
+		return "", fmt.Errorf("%w: WAV format %d with %d bits per sample", ErrUnsupportedFormat, w.AudioFormat, w.BitsPerSample)
+	}
+}
+
+// Reads the SpectraVue style auxi chunk: a start and stop SYSTEMTIME followed by the center frequency
+func parseAuxi(body []byte) Metadata {
+	m := Metadata{}
+	if len(body) < 36 {
+		return m
+	}
+	st := make([]uint16, 8)
+	for i := range st {
+		st[i] = binary.LittleEndian.Uint16(body[2*i:])
+	}
+	// wYear, wMonth, wDayOfWeek, wDay, wHour, wMinute, wSecond, wMilliseconds
+	if st[0] != 0 {
+		m.StartTime = time.Date(int(st[0]), time.Month(st[1]), int(st[3]), int(st[4]), int(st[5]), int(st[6]), int(st[7])*int(time.Millisecond), time.UTC)
+	}
+	m.Frequency = float64(binary.LittleEndian.Uint32(body[32:36]))
+	return m
+}
+
+// Size of the header written by WAVWriter, and where in it the RIFF and data chunk sizes live
+const (
+	wavHeaderSize     = 44
+	wavRIFFSizeOffset = 4
+	wavDataSizeOffset = 40
+)
+
+// Writes a two channel WAV IQ recording. When the output can seek, the chunk sizes are filled in
+// on Close; otherwise they are left at 0xFFFFFFFF, which most readers take to mean "until the end"
+type WAVWriter struct {
+	*RawWriter
+	// Set when out can seek back to the header; pipes to stdout can not
+	seeker   io.WriteSeeker
+	start    int64
+	dataSize int64
+}
+
+// Writes a WAV header to out, and returns a WAVWriter for the samples. Only cu8, cs16, cf32 and
+// cf64 samples can be stored in a WAV file
+func NewWAVWriter(out io.Writer, format SampleFormat, sampleRate float64) (*WAVWriter, error) {
+	wf := wavFormat{Channels: 2, SampleRate: uint32(sampleRate)}
+	switch format {
+	case CU8, CS16:
+		wf.AudioFormat = wavFormatPCM
+	case CF32, CF64:
+		wf.AudioFormat = wavFormatFloat
+	default:
+		return nil, fmt.Errorf("%w: %s can not be stored in a WAV file", ErrUnsupportedFormat, format)
+	}
+	wf.BitsPerSample = uint16(8 * format.componentSize())
+	wf.BlockAlign = uint16(format.SampleSize())
+	wf.ByteRate = wf.SampleRate * uint32(wf.BlockAlign)
+
+	raw, err := NewRawWriter(out, format)
+	if err != nil {
+		return nil, err
+	}
+	w := WAVWriter{RawWriter: raw}
+	if seeker, ok := out.(io.WriteSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			w.seeker = seeker
+			w.start = start
+		}
+	}
+
+	header := make([]byte, 0, wavHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 0xFFFFFFFF)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header, _ = binary.Append(header, binary.LittleEndian, wf)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, 0xFFFFFFFF)
+	if _, err := out.Write(header); err != nil {
+		return nil, fmt.Errorf("Could not write WAV header: %w", err)
+	}
+	return &w, nil
+}
+
+// Creates a WAV IQ file at path
+func CreateWAV(path string, format SampleFormat, sampleRate float64) (*WAVWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create IQ file %s: %w", path, err)
+	}
+	w, err := NewWAVWriter(f, format, sampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+func (w *WAVWriter) WriteSamples(samples []complex64) error {
+	if err := w.RawWriter.WriteSamples(samples); err != nil {
+		return err
+	}
+	w.dataSize += int64(len(samples) * w.sampleFormat.SampleSize())
+	return nil
+}
+
+// Fills in the chunk sizes if the output can seek, and closes the file if the WAVWriter created it
+func (w *WAVWriter) Close() error {
+	if w.seeker != nil {
+		if err := w.writeSizes(w.seeker); err != nil {
+			w.RawWriter.Close()
+			return err
+		}
+	}
+	return w.RawWriter.Close()
+}
+
+func (w *WAVWriter) writeSizes(out io.WriteSeeker) error {
+	if w.dataSize > math.MaxUint32-wavHeaderSize {
+		log.Warnf("WAV data is over 4GiB; leaving its size unset")
+		return nil
+	}
+	sizes := []struct {
+		offset int64
+		size   uint32
+	}{
+		{wavRIFFSizeOffset, uint32(w.dataSize + wavHeaderSize - 8)},
+		{wavDataSizeOffset, uint32(w.dataSize)},
+	}
+	for _, s := range sizes {
+		if _, err := out.Seek(w.start+s.offset, io.SeekStart); err != nil {
+			return fmt.Errorf("Could not update WAV header: %w", err)
+		}
+		if err := binary.Write(out, binary.LittleEndian, s.size); err != nil {
+			return fmt.Errorf("Could not update WAV header: %w", err)
+		}
+	}
+	_, err := out.Seek(0, io.SeekEnd)
+	return err
+}
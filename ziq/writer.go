@@ -0,0 +1,186 @@
+package ziq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/DataDog/zstd"
+	"github.com/charmbracelet/log"
+)
+
+// Compressed bodies are split into zstd frames of this many samples, so that readers can seek
+// without decompressing the whole recording
+const DefaultFrameSamples = 1 << 20
+
+// zstd compression level used unless the Writer is told otherwise
+const DefaultCompressionLevel = zstd.DefaultCompression
+
+type Writer struct {
+	Header       ZiqHeader
+	FrameSamples int64
+	// zstd compression level, and the number of frames to compress at once. These must be set
+	// before the first samples are written
+	Level      int
+	Workers    int
+	out        io.Writer
+	file       *os.File
+	encoder    io.WriteCloser
+	frames     *frameCompressor
+	frameBytes int64
+	buf        []byte
+	closed     bool
+	closeErr   error
+}
+
+// Creates a ziq file at path and writes its header
+func Create(path string, header ZiqHeader) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create ziq file %s: %w", path, err)
+	}
+	w, err := NewWriter(f, header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.file = f
+	return w, nil
+}
+
+// Writes the ziq header to out, and returns a Writer that encodes samples into the body. The
+// Signature and AnnotationLength header fields are filled in from the rest of the header
+func NewWriter(out io.Writer, header ZiqHeader) (*Writer, error) {
+	if FormatForDepth(header.BitsPerSample).componentSize() == 0 {
+		return nil, fmt.Errorf("%w: %d bits per sample", ErrUnsupportedDepth, header.BitsPerSample)
+	}
+	header.Signature = "ZIQ_"
+	header.AnnotationLength = uint64(len(header.Annotation))
+
+	w := Writer{
+		Header:       header,
+		FrameSamples: DefaultFrameSamples,
+		Level:        DefaultCompressionLevel,
+		Workers:      1,
+		out:          out,
+	}
+	if err := w.writeHeader(out); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (w *Writer) writeHeader(out io.Writer) error {
+	h := w.Header
+	for _, field := range []any{[]byte(h.Signature), h.Compressed, h.BitsPerSample, h.SampleRate, h.AnnotationLength, []byte(h.Annotation)} {
+		if err := binary.Write(out, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("Could not write ziq header: %w", err)
+		}
+	}
+	return nil
+}
+
+// Sets up compression on the first write, once the level and workers are known
+func (w *Writer) startCompression() {
+	log.Debugf("Compressing ziq body at level %d with %d workers", w.Level, w.Workers)
+	if w.Workers > 1 && w.FrameSamples > 0 {
+		w.frames = newFrameCompressor(w.out, w.Level, w.Workers, int(w.FrameSamples)*FormatForDepth(w.Header.BitsPerSample).SampleSize())
+		return
+	}
+	w.startFrame()
+	if w.Workers > 1 {
+		// Without frames to spread across workers, let zstd split up the stream itself
+		if err := w.encoder.(*zstd.Writer).SetNbWorkers(w.Workers); err != nil {
+			log.Warnf("Could not compress with %d workers: %s", w.Workers, err.Error())
+		}
+	}
+}
+
+func (w *Writer) startFrame() {
+	w.encoder = zstd.NewWriterLevel(w.out, w.Level)
+	w.frameBytes = 0
+}
+
+// Encodes samples into the ziq body
+func (w *Writer) WriteSamples(samples []complex64) error {
+	format := FormatForDepth(w.Header.BitsPerSample)
+	size := len(samples) * format.SampleSize()
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	data := w.buf[:size]
+	complexSliceToBytes(format, samples, data)
+	return w.WriteBody(data)
+}
+
+// Writes samples that are already in the header's sample format into the ziq body, as they are
+func (w *Writer) WriteBody(data []byte) error {
+	if !w.Header.Compressed {
+		return w.write(w.out, data)
+	}
+	if w.encoder == nil && w.frames == nil {
+		w.startCompression()
+	}
+	if w.frames != nil {
+		return w.frames.write(data)
+	}
+	if w.FrameSamples <= 0 {
+		return w.write(w.encoder, data)
+	}
+
+	frameSize := w.FrameSamples * int64(FormatForDepth(w.Header.BitsPerSample).SampleSize())
+	for len(data) > 0 {
+		if w.frameBytes >= frameSize {
+			if err := w.encoder.Close(); err != nil {
+				return fmt.Errorf("Could not finish compressing ziq frame: %w", err)
+			}
+			w.startFrame()
+		}
+		n := int(min(int64(len(data)), frameSize-w.frameBytes))
+		if err := w.write(w.encoder, data[:n]); err != nil {
+			return err
+		}
+		w.frameBytes += int64(n)
+		data = data[n:]
+	}
+	return nil
+}
+
+func (w *Writer) write(out io.Writer, data []byte) error {
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("Could not write ziq data: %w", err)
+	}
+	return nil
+}
+
+// Flushes the zstd encoder, and closes the file if the Writer was made with Create. The file is
+// closed even if flushing fails, and the first error is returned. Closing again returns the same
+// error without doing anything
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.closeErr
+	}
+	w.closed = true
+
+	var err error
+	if w.Header.Compressed && w.encoder == nil && w.frames == nil {
+		// An empty body is still a zstd frame
+		w.startCompression()
+	}
+	if w.frames != nil {
+		err = w.frames.close()
+	}
+	if w.encoder != nil {
+		if closeErr := w.encoder.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("Could not finish compressing ziq data: %w", closeErr)
+		}
+	}
+	if w.file != nil {
+		if closeErr := w.file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	w.closeErr = err
+	return err
+}
@@ -0,0 +1,147 @@
+package ziq
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// Returns n samples spread across the full scale of a normalized format
+func testSamples(n int) []complex64 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]complex64, n)
+	for i := range samples {
+		samples[i] = complex(rng.Float32()*2-1, rng.Float32()*2-1)
+	}
+	return samples
+}
+
+// Returns how far a component can move on its way through format
+func quantization(format SampleFormat) float64 {
+	switch format {
+	case CS8:
+		return 0.5 / 127
+	case CS16:
+		return 0.5 / 32767
+	default:
+		return 0
+	}
+}
+
+func writeTestZiq(t *testing.T, path string, bps uint8, compressed bool, frameSamples int64, workers int, samples []complex64) {
+	t.Helper()
+	w, err := Create(path, ZiqHeader{Compressed: compressed, BitsPerSample: bps, SampleRate: 2048000, Annotation: `{"frequency": 1694100000}`})
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	w.FrameSamples = frameSamples
+	w.Workers = workers
+	// Write in uneven pieces, so frames do not line up with writes
+	for start := 0; start < len(samples); start += 1000 {
+		if err := w.WriteSamples(samples[start:min(start+1000, len(samples))]); err != nil {
+			t.Fatalf("WriteSamples: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+}
+
+func readAll(t *testing.T, z *Ziq) []complex64 {
+	t.Helper()
+	var out []complex64
+	buf := make([]complex64, 4096)
+	for {
+		n, err := z.ReadSamples(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out
+		} else if err != nil {
+			t.Fatalf("ReadSamples: %s", err)
+		}
+	}
+}
+
+func compareSamples(t *testing.T, format SampleFormat, got, want []complex64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Read %d samples, want %d", len(got), len(want))
+	}
+	tolerance := quantization(format) + 1e-7
+	for i := range want {
+		if math.Abs(float64(real(got[i]-want[i]))) > tolerance || math.Abs(float64(imag(got[i]-want[i]))) > tolerance {
+			t.Fatalf("Sample %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriterLoadRoundTrip(t *testing.T) {
+	samples := testSamples(25000)
+	for _, bps := range []uint8{8, 16, 32} {
+		format := FormatForDepth(bps)
+		for _, tc := range []struct {
+			name         string
+			compressed   bool
+			frameSamples int64
+			workers      int
+		}{
+			{"raw", false, DefaultFrameSamples, 1},
+			{"single frame", true, 0, 1},
+			{"framed", true, 4096, 1},
+			{"parallel frames", true, 4096, 3},
+		} {
+			t.Run(string(format)+"/"+tc.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "test.ziq")
+				writeTestZiq(t, path, bps, tc.compressed, tc.frameSamples, tc.workers, samples)
+
+				z, err := Load(path)
+				if err != nil {
+					t.Fatalf("Load: %s", err)
+				}
+				defer z.Close()
+				if z.Header.Compressed != tc.compressed || z.Header.BitsPerSample != bps || z.SampleRate() != 2048000 {
+					t.Fatalf("Header read back as %+v", z.Header)
+				}
+				if metadata, _ := z.Metadata(); metadata.Frequency != 1694100000 {
+					t.Errorf("Frequency read back as %f", metadata.Frequency)
+				}
+				compareSamples(t, format, readAll(t, z), samples)
+			})
+		}
+	}
+}
+
+func TestWriterEmptyBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.ziq")
+	writeTestZiq(t, path, 8, true, DefaultFrameSamples, 1, nil)
+	z, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer z.Close()
+	if samples := readAll(t, z); len(samples) != 0 {
+		t.Fatalf("Read %d samples from an empty recording", len(samples))
+	}
+}
+
+func TestWriterCloseTwice(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		w, err := Create(filepath.Join(t.TempDir(), "test.ziq"), ZiqHeader{Compressed: true, BitsPerSample: 16, SampleRate: 2048000})
+		if err != nil {
+			t.Fatalf("Create: %s", err)
+		}
+		w.FrameSamples = 4096
+		w.Workers = workers
+		if err := w.WriteSamples(testSamples(10000)); err != nil {
+			t.Fatalf("WriteSamples: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Second Close: %s", err)
+		}
+	}
+}
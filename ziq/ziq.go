@@ -8,130 +8,165 @@ import (
 
 	"github.com/charmbracelet/log"
 	//"github.com/klauspost/compress/zstd"
-	"github.com/DataDog/zstd"
 )
 
+var ErrSignature error = fmt.Errorf("Invalid ziq file; header does not contain ZIQ_")
+var ErrUnsupportedDepth error = fmt.Errorf("Unsupported ziq sample depth")
+var ErrTruncated error = fmt.Errorf("Ziq stream is truncated")
+
 type Ziq struct {
-	path    string
-	Header  ZiqHeader
-	body    []complex64
-	idx     int
-	file    *os.File
-	Done    bool
-	decoder io.Reader
+	path       string
+	Header     ZiqHeader
+	buf        []byte
+	file       *os.File
+	Done       bool
+	decoder    io.ReadCloser
+	bodyOffset int64
+	pos        int64
+	index      *FrameIndex
 }
 
 type ZiqHeader struct {
-	Signature        string
-	Compressed       bool
-	BitsPerSample    uint8
-	SampleRate       uint64
-	AnnotationLength uint64
-	Annotation       string
+	Signature        string `json:"signature"`
+	Compressed       bool   `json:"compressed"`
+	BitsPerSample    uint8  `json:"bits_per_sample"`
+	SampleRate       uint64 `json:"sample_rate"`
+	AnnotationLength uint64 `json:"annotation_length"`
+	Annotation       string `json:"annotation"`
 }
 
-func Load(path string) *Ziq {
+func Load(path string) (*Ziq, error) {
 	log.Debugf("Opening ziq file: %s", path)
-	if f, err := os.Open(path); err == nil {
-		z := Ziq{
-			path: path,
-			file: f,
-		}
-		if err := z.parseHeader(); err != nil {
-			log.Fatal(err)
-			return nil
-		}
-		log.Debugf("Found ziq header %##v", z.Header)
-		if z.Header.Compressed {
-			log.Debugf("Ziq body is compressed...decompressing")
-			z.decoder = zstd.NewReader(z.file)
-		} else {
-			log.Debugf("Ziq body is not compressed")
-			z.decoder = io.NopCloser(f)
-		}
-		return &z
-	} else {
-		log.Errorf("Could not load ziq file %s", path, err.Error())
-		return nil
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load ziq file %s: %w", path, err)
 	}
-}
 
-func bytesToComplexSlice(bps uint8, input []byte, normalize bool) []complex64 {
-	var output []complex64
-	divisor := float32(1.0)
-	if normalize {
-		divisor = float32(127.0)
+	z := Ziq{
+		path: path,
+		file: f,
 	}
-
-	switch bps {
-	case 8:
-		// 8 bit ints
-		for i := 0; i < len(input); i += 2 {
-			r := float32(int8(input[i])) / divisor
-			i := float32(int8(input[i+1])) / divisor
-			output = append(output, complex(r, i))
+	if err := z.parseHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not load ziq file %s: %w", path, err)
+	}
+	log.Debugf("Found ziq header %##v", z.Header)
+	if z.bodyOffset, err = f.Seek(0, io.SeekCurrent); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not load ziq file %s: %w", path, err)
+	}
+	if z.Header.Compressed {
+		log.Debugf("Ziq body is compressed...decompressing")
+		body, err := z.compressedBody()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("Could not load ziq file %s: %w", path, err)
 		}
-	//case 16:
-	//	//16 bit ints
-	//	var in16 []int16
-	//	for i := 0; i < len(input); i += 2 {
-	//		in16 = append(in16, int16(binary.LittleEndian.Uint16(input[i:i+1])))
-	//	}
-
-	//	for i := 0; i < len(in16); i += 2 {
-	//		r := float32(in16[i]) / divisor
-	//		i := float32(in16[i+1]) / divisor
-	//		output = append(output, complex(r, i))
-	//	}
-	//case 32:
-	//	//32 bit floats
-	//	var in32 []float32
-	//	for i := 0; i < len(input); i += 4 {
-	//		in32 = append(in32, float32(binary.LittleEndian.Uint32(input[i:i+3])))
-	//	}
-
-	//	for i := 0; i < len(in32); i += 2 {
-	//		r := in32[i] / divisor
-	//		i := in32[i+1] / divisor
-	//		output = append(output, complex(r, i))
-	//	}
-	default:
-		log.Fatalf("Could not convert samples to complex64!")
-	}
-
-	return output
+		z.decoder = newFrameReader(body, 0)
+	} else {
+		log.Debugf("Ziq body is not compressed")
+		z.decoder = io.NopCloser(f)
+	}
+	return &z, nil
 }
 
 func (z *Ziq) parseHeader() error {
 	h := ZiqHeader{}
 	sig := make([]byte, 4)
-	binary.Read(z.file, binary.LittleEndian, &sig)
-	binary.Read(z.file, binary.LittleEndian, &h.Compressed)
-	binary.Read(z.file, binary.LittleEndian, &h.BitsPerSample)
-	binary.Read(z.file, binary.LittleEndian, &h.SampleRate)
-	binary.Read(z.file, binary.LittleEndian, &h.AnnotationLength)
+	for _, field := range []any{&sig, &h.Compressed, &h.BitsPerSample, &h.SampleRate, &h.AnnotationLength} {
+		if err := binary.Read(z.file, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("%w: could not read header: %w", ErrTruncated, err)
+		}
+	}
 	h.Signature = string(sig)
 	if h.Signature != "ZIQ_" {
-		return fmt.Errorf("Invalid ziq file found; header does not contain ZIQ_")
+		return ErrSignature
+	}
+
+	if FormatForDepth(h.BitsPerSample).componentSize() == 0 {
+		return fmt.Errorf("%w: %d bits per sample", ErrUnsupportedDepth, h.BitsPerSample)
 	}
 
 	if h.AnnotationLength > 0 {
 		annotation := make([]byte, h.AnnotationLength)
-		io.ReadFull(z.file, annotation)
+		if _, err := io.ReadFull(z.file, annotation); err != nil {
+			return fmt.Errorf("%w: could not read annotation: %w", ErrTruncated, err)
+		}
 		h.Annotation = string(annotation)
 	}
 	z.Header = h
 	return nil
 }
 
-func (z *Ziq) GetNextChunk(size int) []complex64 {
-	data := make([]byte, size*2)
-	if _, err := io.ReadFull(z.decoder, data); err != nil {
+// Reads up to len(dst) samples into dst. Returns io.EOF once the body has been fully read, and
+// ErrTruncated if the body ends partway through a sample
+func (z *Ziq) ReadSamples(dst []complex64) (int, error) {
+	if z.Done {
+		return 0, io.EOF
+	}
+
+	// Each sample is an I and a Q component
+	sampleSize := int(z.sampleSize())
+	if cap(z.buf) < len(dst)*sampleSize {
+		z.buf = make([]byte, len(dst)*sampleSize)
+	}
+	data := z.buf[:len(dst)*sampleSize]
+
+	read, err := z.readBody(data)
+	n, _ := bytesToComplexSlice(z.format(), data[:read], dst, true)
+	return n, err
+}
+
+// Fills data with raw sample bytes from the body, returning the number of bytes read. Follows
+// the same end of stream rules as ReadSamples
+func (z *Ziq) readBody(data []byte) (int, error) {
+	if z.Done {
+		return 0, io.EOF
+	}
+
+	sampleSize := int(z.sampleSize())
+	read, err := io.ReadFull(z.decoder, data)
+	if err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Fatalf("Could not read ZIQ data %s", err)
-		} else {
-			z.Done = true
+			return 0, fmt.Errorf("Could not read ziq data: %w", err)
 		}
+		z.Done = true
+	}
+
+	z.pos += int64(read / sampleSize)
+	if read%sampleSize != 0 {
+		return read, ErrTruncated
+	}
+	if read == 0 && z.Done {
+		return 0, io.EOF
+	}
+	return read, nil
+}
+
+// Returns the next chunk of at most size samples. The returned slice is empty along with io.EOF
+// once the body has been fully read
+func (z *Ziq) GetNextChunk(size int) ([]complex64, error) {
+	samples := make([]complex64, size)
+	n, err := z.ReadSamples(samples)
+	return samples[:n], err
+}
+
+// Returns the sample rate from the ziq header
+func (z *Ziq) SampleRate() float64 {
+	return float64(z.Header.SampleRate)
+}
+
+// Returns the recording metadata parsed from the ziq header
+func (z *Ziq) Metadata() (Metadata, error) {
+	return z.Header.Metadata()
+}
+
+// Releases the zstd decoder and the underlying file
+func (z *Ziq) Close() error {
+	z.Done = true
+	decErr := z.decoder.Close()
+	if err := z.file.Close(); err != nil {
+		return err
 	}
-	return bytesToComplexSlice(z.Header.BitsPerSample, data, true)
+	return decErr
 }